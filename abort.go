@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+)
+
+// StatusClientClosedRequest (499) is the non standard status, popularised by nginx,
+// used to record that the client closed the request before the server could respond
+const StatusClientClosedRequest = 499
+
+// AbortAwareOptions defines the user supplied AbortAware configuration options.
+type AbortAwareOptions struct {
+	// OnAbort is called with the request & the body's read error when the client aborts the upload, e.g. to log or count aborts.
+	// Default: the abort is logged
+	OnAbort func(r *http.Request, err error)
+}
+
+// AbortAware middleware detects clients aborting a request while its body is being uploaded.
+// An upload is considered aborted when reading the request body fails because the request context was canceled,
+// or because the body was cut short. The response status is then replaced with StatusClientClosedRequest (499),
+// so that the abort isn't mistaken for a server error by loggers & metrics further up the chain.
+// Placed inside the Transaction middleware, an aborted upload causes the transaction to rollback. Aborts are logged
+func AbortAware() Middleware {
+	return AbortAwareWithOptions(AbortAwareOptions{})
+}
+
+// AbortAwareWithOptions middleware is AbortAware configured with the supplied AbortAwareOptions
+func AbortAwareWithOptions(opts AbortAwareOptions) Middleware {
+	if opts.OnAbort == nil {
+		opts.OnAbort = logAbort
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			var body *abortReader
+			if r.Body != nil {
+				body = &abortReader{ctx: r.Context(), body: r.Body}
+				r.Body = body
+			}
+
+			sw := &statusWriter{rw: w, buf: bytes.NewBuffer(nil)}
+			next.ServeHTTP(sw, r)
+
+			if body != nil && body.err != nil {
+				sw.status = StatusClientClosedRequest
+				sw.buf.Reset()
+				opts.OnAbort(r, body.err)
+			}
+			sw.Finish()
+		})
+	}
+}
+
+// logAbort logs the aborted upload
+func logAbort(r *http.Request, err error) {
+	log.Printf("middleware: %s %s upload aborted by the client (%v), responding %d", r.Method, r.URL.Path, err, StatusClientClosedRequest)
+}
+
+// abortReader wraps the request body to detect the client aborting the upload
+type abortReader struct {
+	ctx  context.Context
+	body io.ReadCloser
+	err  error // the read error, once the upload has been aborted
+}
+
+// Read reads from the request body, recording the error if the read failed because the client went away
+func (ar *abortReader) Read(p []byte) (int, error) {
+	if err := ar.ctx.Err(); err == context.Canceled {
+		ar.err = err
+		return 0, err
+	}
+	n, err := ar.body.Read(p)
+	if err == io.ErrUnexpectedEOF || (err != nil && err != io.EOF && ar.ctx.Err() == context.Canceled) {
+		ar.err = err
+	}
+	return n, err
+}
+
+// Close closes the request body
+func (ar *abortReader) Close() error {
+	return ar.body.Close()
+}
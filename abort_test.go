@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// cancelingReader cancels the request context part way through reading the body, simulating the client going away
+type cancelingReader struct {
+	cancel context.CancelFunc
+	reads  int
+}
+
+func (cr *cancelingReader) Read(p []byte) (int, error) {
+	cr.reads++
+	if cr.reads > 1 {
+		cr.cancel()
+	}
+	return copy(p, "partial"), nil
+}
+
+// TestAbortAwareCanceledUpload tests that a canceled upload is classified as StatusClientClosedRequest and rolled back
+func TestAbortAwareCanceledUpload(t *testing.T) {
+
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r, _ := http.NewRequest("POST", "/upload", &cancelingReader{cancel: cancel})
+	r = r.WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	// the canceled context makes database/sql roll back in the background, so the rollback is asserted by the commit hook
+	// not being called, rather than by sqlmock's expectations which would race with it
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	committed := false
+	handler := Transaction(db)(AbortAware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		OnCommit(r.Context(), func() { committed = true })
+		if _, err := ioutil.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != StatusClientClosedRequest {
+		t.Fatalf("StatusClientClosedRequest 499 expected but was %v", w.Code)
+	}
+	if committed {
+		t.Fatal("Expected the transaction to be rolled back but it was committed")
+	}
+}
+
+// TestAbortAwareOnAbort tests that the OnAbort hook is given the aborted request & its read error, & isn't called for a completed upload
+func TestAbortAwareOnAbort(t *testing.T) {
+
+	tests := []struct {
+		aborted bool
+		status  int
+	}{
+		{true, StatusClientClosedRequest},
+		{false, http.StatusCreated},
+	}
+
+	for _, test := range tests {
+
+		// Arrange
+		ctx, cancel := context.WithCancel(context.Background())
+		r, _ := http.NewRequest("POST", "/upload", strings.NewReader("complete"))
+		if test.aborted {
+			r, _ = http.NewRequest("POST", "/upload", &cancelingReader{cancel: cancel})
+		}
+		r = r.WithContext(ctx)
+		w := httptest.NewRecorder()
+
+		var abortedPath string
+		var abortErr error
+		options := AbortAwareOptions{OnAbort: func(r *http.Request, err error) {
+			abortedPath, abortErr = r.URL.Path, err
+		}}
+		handler := AbortAwareWithOptions(options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+		}))
+
+		// Act
+		handler.ServeHTTP(w, r)
+		cancel()
+
+		// Assert
+		if w.Code != test.status {
+			t.Fatalf("Status %v expected but was %v", test.status, w.Code)
+		}
+		if test.aborted && (abortedPath != "/upload" || abortErr != context.Canceled) {
+			t.Fatalf("Expected the abort of /upload to be reported with context.Canceled but was %s %v", abortedPath, abortErr)
+		}
+		if !test.aborted && abortErr != nil {
+			t.Fatalf("Expected a completed upload not to be reported but was %v", abortErr)
+		}
+	}
+}
+
+// TestAbortAwareCompletedUpload tests that a completed upload keeps the handler's status
+func TestAbortAwareCompletedUpload(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/upload", strings.NewReader("complete"))
+	w := httptest.NewRecorder()
+	handler := AbortAware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := ioutil.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusCreated {
+		t.Fatalf("StatusCreated 201 expected but was %v", w.Code)
+	}
+}
+
+// TestAbortAwareServerError tests that a server error which isn't caused by an abort isn't reclassified
+func TestAbortAwareServerError(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/upload", strings.NewReader("complete"))
+	w := httptest.NewRecorder()
+	handler := AbortAware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("StatusInternalServerError 500 expected but was %v", w.Code)
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+// NegroniHandlerFunc has the signature of negroni.HandlerFunc, so converts directly to & from it,
+// e.g. negroni.HandlerFunc(ToNegroni(Transaction(db)))
+type NegroniHandlerFunc func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc)
+
+// ToAlice returns the middleware as an alice.Constructor. Middleware already has the func(http.Handler) http.Handler shape
+// of alice.Constructor, so this only documents the conversion, e.g. alice.New(ToAlice(HTTPS), ToAlice(JWT(options)))
+func ToAlice(m Middleware) func(http.Handler) http.Handler {
+	return m
+}
+
+// ToNegroni adapts the middleware for use in a negroni chain. The rest of the chain is called as the middleware's next handler.
+// The middleware is built once, so any state it keeps, e.g. a limiter, is shared by every request. Each request's negroni
+// next handler is carried to it on the request context
+func ToNegroni(m Middleware) NegroniHandlerFunc {
+	handler := m(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next, _ := r.Context().Value(negroniNextKey).(http.HandlerFunc)
+		if next != nil {
+			next(w, r)
+		}
+	}))
+	return func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		ctx := context.WithValue(r.Context(), negroniNextKey, next)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+// negroni next context key
+var negroniNextKey = &contextKey{"NegroniNext"}
+
+// FromNegroni adapts a negroni style handler, e.g. a negroni.HandlerFunc, into a Middleware so it can be used in a Chain
+func FromNegroni(h func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc)) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h(w, r, next.ServeHTTP)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// TestToNegroni tests that a middleware invoked negroni style calls the rest of the chain as its next handler
+func TestToNegroni(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	r.Header.Add("x-forwarded-proto", "https")
+	w := httptest.NewRecorder()
+	handler := ToNegroni(Chain(HTTPS, appendHeader("A")))
+
+	// Act
+	handler(w, r, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Order", "next")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// Assert
+	expected := []string{"A in", "next", "A out"}
+	if order := w.Header()["X-Order"]; !reflect.DeepEqual(order, expected) {
+		t.Fatalf("Expected the negroni next handler to be called in the order %v but was %v", expected, order)
+	}
+}
+
+// TestToNegroniShortCircuit tests that a middleware which responds itself doesn't call the negroni next handler
+func TestToNegroniShortCircuit(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	r.Host = "example.com"
+	r.Header.Add("x-forwarded-proto", "http")
+	w := httptest.NewRecorder()
+	handler := ToNegroni(HTTPS)
+
+	// Act
+	handler(w, r, func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	})
+
+	// Assert
+	if w.Code != http.StatusPermanentRedirect {
+		t.Fatalf("StatusPermanentRedirect 308 expected - %d", w.Code)
+	}
+}
+
+// TestToNegroniStateful tests that the middleware is built once, so state it keeps is shared across requests
+func TestToNegroniStateful(t *testing.T) {
+
+	// Arrange
+	builds := 0
+	counter := func(next http.Handler) http.Handler {
+		builds++
+		requests := 0
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Header().Set("X-Requests", strconv.Itoa(requests))
+			next.ServeHTTP(w, r)
+		})
+	}
+	handler := ToNegroni(counter)
+	next := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	// Act
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/test", nil), next)
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/test", nil), next)
+
+	// Assert
+	if builds != 1 {
+		t.Fatalf("Expected the middleware to be built once but was built %v times", builds)
+	}
+	if h := w.Header().Get("X-Requests"); h != "2" {
+		t.Fatalf("Expected the second request to see the shared count 2 but was %s", h)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the negroni next handler to be called but the status was %v", w.Code)
+	}
+}
+
+// TestFromNegroni tests that a negroni style handler can be used in a Chain
+func TestFromNegroni(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	w := httptest.NewRecorder()
+	negroniHandler := func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		w.Header().Add("X-Order", "negroni")
+		next(w, r)
+	}
+	handler := Chain(FromNegroni(negroniHandler), appendHeader("A")).Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Order", "handler")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	expected := []string{"negroni", "A in", "handler", "A out"}
+	if order := w.Header()["X-Order"]; !reflect.DeepEqual(order, expected) {
+		t.Fatalf("Expected the order %v but was %v", expected, order)
+	}
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// AdvisoryLock middleware acquires a Postgres transaction level advisory lock, keyed by the integer keyFn derives from the request,
+// using the transaction in the request context. Concurrent requests mutating the same logical resource are serialized
+// until the transaction commits or rolls back, at which point Postgres releases the lock.
+// It must run after Transaction. If there isn't a transaction in the context, or the lock can't be acquired, a 500 is returned
+func AdvisoryLock(keyFn func(*http.Request) int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			tx, ok := GetTransactionOk(ctx)
+			if !ok {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", keyFn(r))
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
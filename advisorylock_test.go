@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// TestAdvisoryLockAcquired tests that the advisory lock is taken with the derived key before the handler runs
+func TestAdvisoryLockAcquired(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/accounts/42", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").WithArgs(int64(42)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	keyFn := func(r *http.Request) int64 {
+		return 42
+	}
+	handler := Transaction(db)(AdvisoryLock(keyFn)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unmet sql expectations: %v", err)
+	}
+}
+
+// TestAdvisoryLockError tests that a 500 is returned & the transaction rolled back when the lock can't be acquired
+func TestAdvisoryLockError(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/accounts/42", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").WithArgs(int64(42)).WillReturnError(errors.New("Lock timeout"))
+	mock.ExpectRollback()
+
+	keyFn := func(r *http.Request) int64 {
+		return 42
+	}
+	handler := Transaction(db)(AdvisoryLock(keyFn)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	})))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("StatusInternalServerError 500 expected but was %v", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unmet sql expectations: %v", err)
+	}
+}
+
+// TestAdvisoryLockNoTransaction tests that a 500 is returned when AdvisoryLock isn't run after Transaction
+func TestAdvisoryLockNoTransaction(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/accounts/42", nil)
+	w := httptest.NewRecorder()
+
+	keyFn := func(r *http.Request) int64 {
+		return 42
+	}
+	handler := AdvisoryLock(keyFn)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("StatusInternalServerError 500 expected but was %v", w.Code)
+	}
+}
@@ -0,0 +1,8 @@
+package middleware
+
+// APIKey middleware authenticates service to service traffic using an API key sent in the named header, e.g. X-API-Key.
+// The key is validated by the supplied AuthFunc, whose returned context is used with further chained http handlers.
+// A StatusUnauthorized (401) is returned if the header is missing or the AuthFunc returns an error
+func APIKey(header string, validate AuthFunc) Middleware {
+	return AuthWithOptions(AuthOptions{Header: header, AuthFunc: validate})
+}
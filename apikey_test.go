@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// validateAPIKey is an AuthFunc which only accepts the key s3cr3t, adding the calling service to the context
+func validateAPIKey(ctx context.Context, key string) (context.Context, error) {
+	if key != "s3cr3t" {
+		return ctx, errors.New("Unknown API key")
+	}
+	return context.WithValue(ctx, userContextKey, "billing-service"), nil
+}
+
+// TestAPIKeyNoHeader tests that StatusUnauthorized is returned when the API key header isn't set
+func TestAPIKeyNoHeader(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", "s3cr3t")
+	w := httptest.NewRecorder()
+	auth := APIKey("X-API-Key", validateAPIKey)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("StatusUnauthorized 401 expected but was %v", w.Code)
+	}
+}
+
+// TestAPIKeyValidKey tests that the next handler is called with the validator's context for a valid key
+func TestAPIKeyValidKey(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("X-API-Key", "s3cr3t")
+	w := httptest.NewRecorder()
+	auth := APIKey("X-API-Key", validateAPIKey)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Context().Value(userContextKey) != "billing-service" {
+			t.Fatal("Expected the calling service to be set on the request context")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
@@ -2,34 +2,143 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"strings"
 )
 
 // AuthFunc defines the user supplied function to implement Authorisation
 // It is given the current request context and the Authorization header value
 // and returns the context object to use with further chained http handlers.
-// If an err is returned chained http handlers are not called
+// A nil error means the request is authorised. If an err is returned chained http handlers are not called
+// & a 401 Unauthorized is returned, or a 403 Forbidden if the error is ErrForbidden.
+//
+// Migrating from the previous func(context.Context, string) (bool, context.Context) signature:
+// swap the order of the return values & return a non nil error instead of false, e.g.
+// return ctx, nil when authorised & return ctx, errors.New("Unauthorized") when not
 type AuthFunc func(context.Context, string) (context.Context, error)
 
 // Auth middleware is responsible handling request authentication
-// The authentication is handled by the supplied AuthFunc
+// The authentication is handled by the supplied AuthFunc.
+// A StatusUnauthorized (401) is returned if the Authorization header is missing or the AuthFunc returns an error.
+// It returns a Middleware so it can be chained like the package's other middleware, e.g. Auth(authFunc)(next)
 func Auth(authFunc AuthFunc) Middleware {
+	return AuthWithOptions(AuthOptions{AuthFunc: authFunc})
+}
+
+// ErrMissingCredentials is passed to the AuthErrorFunc when the request doesn't have any credentials
+var ErrMissingCredentials = errors.New("Missing credentials")
+
+// ErrForbidden is returned, or wrapped, by an AuthFunc or JWTFunc when the credentials are valid but don't permit access,
+// so that a StatusForbidden (403) is returned rather than a StatusUnauthorized (401)
+var ErrForbidden = errors.New("Forbidden")
+
+// AuthErrors is the error returned by AnyAuth when every AuthFunc fails. It holds each AuthFunc's error, in order
+type AuthErrors []error
+
+// Error joins the AuthFuncs' errors
+func (errs AuthErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// AnyAuth combines the AuthFuncs so the request is authorised if any of them pass, e.g. to accept either a JWT or an API key.
+// They're tried in order, with the first to succeed providing the context. If they all fail the AuthErrors are returned,
+// so a StatusUnauthorized (401) is returned & the OnError hook can inspect each failure
+func AnyAuth(authFuncs ...AuthFunc) AuthFunc {
+	return func(ctx context.Context, credentials string) (context.Context, error) {
+		errs := make(AuthErrors, 0, len(authFuncs))
+		for _, authFunc := range authFuncs {
+			authCtx, err := authFunc(ctx, credentials)
+			if err == nil {
+				return authCtx, nil
+			}
+			errs = append(errs, err)
+		}
+		return ctx, errs
+	}
+}
+
+// AuthErrorFunc defines a user supplied function which writes the response for a failed authentication.
+// It's given the underlying error, e.g. ErrMissingCredentials, the TokenExtractor's error, the token parsing error or the AuthFunc's error
+type AuthErrorFunc func(w http.ResponseWriter, r *http.Request, err error)
+
+// AuthOptions defines the user supplied Auth configuration options.
+type AuthOptions struct {
+	AuthFunc AuthFunc
+	// Header is the request header the credentials are read from. Default: Authorization
+	Header string
+	// OnError writes the response when authentication fails, e.g. to write a JSON error envelope
+	// Default: an empty StatusUnauthorized (401) response, or StatusForbidden (403) for ErrForbidden
+	OnError AuthErrorFunc
+	// OnSuccess is called, e.g. for auditing or metrics, when authentication succeeds, right before the next handler.
+	// It's given the request with the context returned by the AuthFunc
+	OnSuccess func(r *http.Request)
+}
+
+// AuthWithOptions middleware is Auth configured with the supplied AuthOptions
+func AuthWithOptions(options AuthOptions) Middleware {
+	if options.Header == "" {
+		options.Header = "Authorization"
+	}
+	return authMiddleware(headerCredentials(options.Header), options.AuthFunc, options.OnError, options.OnSuccess)
+}
+
+// unauthorized is the default AuthErrorFunc, it writes a StatusUnauthorized (401),
+// or a StatusForbidden (403) when access was denied with ErrForbidden
+func unauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrForbidden) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+// credentialsFunc reads the credentials to authenticate from the request.
+// An empty string is returned when the request doesn't have any credentials
+type credentialsFunc func(r *http.Request) (string, error)
+
+// headerCredentials reads the credentials from the named request header
+func headerCredentials(header string) credentialsFunc {
+	return func(r *http.Request) (string, error) {
+		return r.Header.Get(header), nil
+	}
+}
+
+// authMiddleware authenticates the credentials read from the request using the AuthFunc.
+// Failures are handled by onError, or a StatusUnauthorized (401), or StatusForbidden (403) for ErrForbidden, if it's nil.
+// onSuccess, if not nil, is called with the authenticated request before the next handler
+func authMiddleware(credentials credentialsFunc, authFunc AuthFunc, onError AuthErrorFunc, onSuccess func(r *http.Request)) Middleware {
+	if onError == nil {
+		onError = unauthorized
+	}
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
-			auth := r.Header.Get("Authorization")
+			auth, err := credentials(r)
+			if err != nil {
+				// malformed credentials
+				onError(w, r, err)
+				return
+			}
 			if auth == "" {
-				// missing header
-				w.WriteHeader(http.StatusUnauthorized)
-				// w.Write(errors.New("unauthorized: no authentication provided").Error())
+				// missing credentials
+				onError(w, r, ErrMissingCredentials)
 				return
 			}
 			ctx, err := authFunc(r.Context(), auth)
 			if err != nil {
 				// unauthorised
-				w.WriteHeader(http.StatusUnauthorized)
+				onError(w, r, err)
 				return
 			}
-			next.ServeHTTP(w, r.WithContext(ctx))
+			r = r.WithContext(ctx)
+			if onSuccess != nil {
+				onSuccess(r)
+			}
+			next.ServeHTTP(w, r)
 		}
 		return http.HandlerFunc(fn)
 	}
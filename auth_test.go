@@ -2,9 +2,12 @@ package middleware
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -103,4 +106,234 @@ func TestAuthOkAddToContext(t *testing.T) {
 	}
 }
 
+// jsonAuthError is an AuthErrorFunc which writes a JSON error envelope
+func jsonAuthError(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]string{"code": "unauthorized", "message": err.Error()})
+}
+
+// TestAuthWithOptionsOnError tests that the OnError handler writes the response, & is given the AuthFunc's error
+func TestAuthWithOptionsOnError(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", "would_I_lie_to_you")
+	w := httptest.NewRecorder()
+	authFunc := func(ctx context.Context, authHeader string) (context.Context, error) {
+		return ctx, errors.New("Not authorised")
+	}
+	auth := AuthWithOptions(AuthOptions{AuthFunc: authFunc, OnError: jsonAuthError})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("StatusForbidden 403 expected but was %v", w.Code)
+	}
+	if body := strings.TrimSpace(w.Body.String()); body != `{"code":"unauthorized","message":"Not authorised"}` {
+		t.Fatalf("Expected a JSON error body but was %v", body)
+	}
+}
+
+// TestAuthWithOptionsOnErrorMissingCredentials tests that the OnError handler is given ErrMissingCredentials when there's no Authorization header
+func TestAuthWithOptionsOnErrorMissingCredentials(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	authFunc := func(ctx context.Context, authHeader string) (context.Context, error) {
+		return ctx, nil
+	}
+	var authErr error
+	onError := func(w http.ResponseWriter, r *http.Request, err error) {
+		authErr = err
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	auth := AuthWithOptions(AuthOptions{AuthFunc: authFunc, OnError: onError})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if authErr != ErrMissingCredentials {
+		t.Fatalf("Expected ErrMissingCredentials but was %v", authErr)
+	}
+}
+
 var userContextKey = &contextKey{"user"}
+
+// TestAuthFuncForbidden tests that StatusForbidden is returned when the authFunc denies access with ErrForbidden,
+// while other errors remain StatusUnauthorized
+func TestAuthFuncForbidden(t *testing.T) {
+
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{ErrForbidden, http.StatusForbidden},
+		{fmt.Errorf("User is suspended: %w", ErrForbidden), http.StatusForbidden},
+		{errors.New("Invalid token"), http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+
+		// Arrange
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Add("Authorization", "would_I_lie_to_you")
+		w := httptest.NewRecorder()
+		authFunc := func(ctx context.Context, authHeader string) (context.Context, error) {
+			return ctx, test.err
+		}
+		auth := Auth(authFunc)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Fatal("Next handler should not have been called")
+		}))
+
+		// Act
+		auth.ServeHTTP(w, r)
+
+		// Assert
+		if w.Code != test.status {
+			t.Fatalf("Status %v expected for error %v but was %v", test.status, test.err, w.Code)
+		}
+	}
+}
+
+// TestAuthWithOptionsOnSuccess tests that the OnSuccess callback is given the authenticated request, but not called on failure
+func TestAuthWithOptionsOnSuccess(t *testing.T) {
+
+	tests := []struct {
+		authorization string
+		called        bool
+	}{
+		{"valid", true},
+		{"invalid", false},
+	}
+
+	for _, test := range tests {
+
+		// Arrange
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Add("Authorization", test.authorization)
+		w := httptest.NewRecorder()
+		var user interface{}
+		options := AuthOptions{
+			AuthFunc: func(ctx context.Context, authHeader string) (context.Context, error) {
+				if authHeader != "valid" {
+					return ctx, errors.New("Invalid credentials")
+				}
+				return context.WithValue(ctx, userContextKey, "user-1"), nil
+			},
+			OnSuccess: func(r *http.Request) {
+				user = r.Context().Value(userContextKey)
+			},
+		}
+		auth := AuthWithOptions(options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		// Act
+		auth.ServeHTTP(w, r)
+
+		// Assert
+		if called := user != nil; called != test.called {
+			t.Fatalf("Expected OnSuccess to be called %v for %s credentials but was %v", test.called, test.authorization, called)
+		}
+		if test.called && user != "user-1" {
+			t.Fatalf("Expected OnSuccess to receive the AuthFunc's context but was %v", user)
+		}
+	}
+}
+
+// TestAnyAuth tests that the request is authorised by the first AuthFunc to pass, using its context
+func TestAnyAuth(t *testing.T) {
+
+	jwtAuth := func(ctx context.Context, authHeader string) (context.Context, error) {
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			return ctx, errors.New("Not a JWT")
+		}
+		return context.WithValue(ctx, userContextKey, "jwt"), nil
+	}
+	apiKeyAuth := func(ctx context.Context, authHeader string) (context.Context, error) {
+		if authHeader != "key-123" {
+			return ctx, errors.New("Unknown API key")
+		}
+		return context.WithValue(ctx, userContextKey, "apikey"), nil
+	}
+
+	tests := []struct {
+		authorization string
+		user          string
+	}{
+		{"Bearer token", "jwt"},
+		{"key-123", "apikey"},
+	}
+
+	for _, test := range tests {
+
+		// Arrange
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Add("Authorization", test.authorization)
+		w := httptest.NewRecorder()
+		auth := Auth(AnyAuth(jwtAuth, apiKeyAuth))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user := r.Context().Value(userContextKey); user != test.user {
+				t.Fatalf("Expected the context of the %s AuthFunc but was %v", test.user, user)
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		// Act
+		auth.ServeHTTP(w, r)
+
+		// Assert
+		if w.Code != http.StatusOK {
+			t.Fatalf("StatusOK 200 expected for %s but was %v", test.authorization, w.Code)
+		}
+	}
+}
+
+// TestAnyAuthAllFail tests that StatusUnauthorized is returned when every AuthFunc fails, with their errors combined
+func TestAnyAuthAllFail(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", "nope")
+	w := httptest.NewRecorder()
+	first := func(ctx context.Context, authHeader string) (context.Context, error) {
+		return ctx, errors.New("First failed")
+	}
+	second := func(ctx context.Context, authHeader string) (context.Context, error) {
+		return ctx, errors.New("Second failed")
+	}
+	var authErr error
+	options := AuthOptions{
+		AuthFunc: AnyAuth(first, second),
+		OnError: func(w http.ResponseWriter, r *http.Request, err error) {
+			authErr = err
+			w.WriteHeader(http.StatusUnauthorized)
+		},
+	}
+	auth := AuthWithOptions(options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("StatusUnauthorized 401 expected but was %v", w.Code)
+	}
+	errs, ok := authErr.(AuthErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("Expected both AuthFuncs' errors but was %v", authErr)
+	}
+	if authErr.Error() != "First failed; Second failed" {
+		t.Fatalf("Expected the combined error message but was %s", authErr.Error())
+	}
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// BasicAuthFunc defines the user supplied function which validates HTTP Basic credentials.
+// It is given the current request context, the username & the password
+// and returns the context object to use with further chained http handlers.
+// If an err is returned chained http handlers are not called.
+// Compare the credentials using subtle.ConstantTimeCompare, rather than ==, so that
+// the time taken to reject a password doesn't leak how much of it was correct
+type BasicAuthFunc func(ctx context.Context, user, pass string) (context.Context, error)
+
+// BasicAuthOptions defines the user supplied BasicAuth configuration options.
+type BasicAuthOptions struct {
+	// Realm is sent in the WWW-Authenticate header of unauthorized responses. Default: Restricted
+	Realm    string
+	Validate BasicAuthFunc
+	// OnError writes the response when authentication fails. The WWW-Authenticate header is set before it's called,
+	// unless access was denied with ErrForbidden
+	// Default: an empty StatusUnauthorized (401) response
+	OnError AuthErrorFunc
+}
+
+// BasicAuth middleware handles HTTP Basic authentication.
+// The credentials are decoded from the Authorization: Basic header & validated by the supplied BasicAuthFunc.
+// A StatusUnauthorized (401), with a WWW-Authenticate header, is returned when the credentials are missing, malformed or invalid
+func BasicAuth(validate BasicAuthFunc) Middleware {
+	return BasicAuthWithOptions(BasicAuthOptions{Validate: validate})
+}
+
+// BasicAuthWithOptions middleware is BasicAuth configured with the supplied BasicAuthOptions
+func BasicAuthWithOptions(options BasicAuthOptions) Middleware {
+
+	if options.Realm == "" {
+		options.Realm = "Restricted"
+	}
+	if options.OnError == nil {
+		options.OnError = unauthorized
+	}
+
+	challenge := fmt.Sprintf("Basic realm=%q", options.Realm)
+	onError := func(w http.ResponseWriter, r *http.Request, err error) {
+		// a forbidden user is authenticated, so there's no need to challenge for credentials
+		if !errors.Is(err, ErrForbidden) {
+			w.Header().Set("WWW-Authenticate", challenge)
+		}
+		options.OnError(w, r, err)
+	}
+
+	authFunc := func(ctx context.Context, credentials string) (context.Context, error) {
+		decoded, err := base64.StdEncoding.DecodeString(credentials)
+		if err != nil {
+			return ctx, err
+		}
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) != 2 {
+			return ctx, errors.New("Basic credentials must be in the format {user}:{password}")
+		}
+		return options.Validate(ctx, parts[0], parts[1])
+	}
+
+	return authMiddleware(basicCredentials, authFunc, onError, nil)
+}
+
+// basicCredentials reads the base64 encoded credentials from the Authorization: Basic header
+func basicCredentials(r *http.Request) (string, error) {
+	authHeaderValue := r.Header.Get("Authorization")
+	if authHeaderValue == "" {
+		return "", nil
+	}
+	authHeaderParts := strings.SplitN(authHeaderValue, " ", 2)
+	if len(authHeaderParts) != 2 || !strings.EqualFold(authHeaderParts[0], "basic") {
+		return "", errors.New("Authorization header format must be Basic {credentials}")
+	}
+	return authHeaderParts[1], nil
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// validateAdmin is a BasicAuthFunc which only accepts admin:hunter2
+func validateAdmin(ctx context.Context, user, pass string) (context.Context, error) {
+	userOk := subtle.ConstantTimeCompare([]byte(user), []byte("admin")) == 1
+	passOk := subtle.ConstantTimeCompare([]byte(pass), []byte("hunter2")) == 1
+	if !userOk || !passOk {
+		return ctx, errors.New("Invalid credentials")
+	}
+	return context.WithValue(ctx, userContextKey, user), nil
+}
+
+// TestBasicAuthNoHeader tests that StatusUnauthorized, with a WWW-Authenticate challenge, is returned when no Authorization header is set
+func TestBasicAuthNoHeader(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	auth := BasicAuth(validateAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("StatusUnauthorized 401 expected but was %v", w.Code)
+	}
+	if h := w.Header().Get("WWW-Authenticate"); h != `Basic realm="Restricted"` {
+		t.Fatalf("Expected WWW-Authenticate header Basic realm=\"Restricted\" but was %s", h)
+	}
+}
+
+// TestBasicAuthMalformedBase64 tests that StatusUnauthorized is returned when the credentials aren't valid base64
+func TestBasicAuthMalformedBase64(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", "Basic not*base64")
+	w := httptest.NewRecorder()
+	auth := BasicAuthWithOptions(BasicAuthOptions{Realm: "Admin", Validate: validateAdmin})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("StatusUnauthorized 401 expected but was %v", w.Code)
+	}
+	if h := w.Header().Get("WWW-Authenticate"); h != `Basic realm="Admin"` {
+		t.Fatalf("Expected WWW-Authenticate header Basic realm=\"Admin\" but was %s", h)
+	}
+}
+
+// TestBasicAuthWrongCredentials tests that StatusUnauthorized is returned when the validator rejects the credentials
+func TestBasicAuthWrongCredentials(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.SetBasicAuth("admin", "password1")
+	w := httptest.NewRecorder()
+	auth := BasicAuth(validateAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("StatusUnauthorized 401 expected but was %v", w.Code)
+	}
+}
+
+// TestBasicAuthOk tests that the next handler is called with the validator's context when the credentials are valid
+func TestBasicAuthOk(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.SetBasicAuth("admin", "hunter2")
+	w := httptest.NewRecorder()
+	auth := BasicAuth(validateAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Context().Value(userContextKey) != "admin" {
+			t.Fatal("Expected user to be set on the request context")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	if h := w.Header().Get("WWW-Authenticate"); h != "" {
+		t.Fatalf("Expected no WWW-Authenticate header but was %s", h)
+	}
+}
@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// BatchRequest is a single request within a batch
+type BatchRequest struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Header http.Header     `json:"header,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// BatchResponse is the response to a single request within a batch
+type BatchResponse struct {
+	Status int             `json:"status"`
+	Header http.Header     `json:"header,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// BatchOptions defines the user supplied Batch configuration options.
+type BatchOptions struct {
+	// Atomic fails the whole batch with the status of the first unsuccessful request.
+	// Combined with the Transaction middleware this rolls back every request in the batch
+	// Default: false, the batch is successful regardless of its requests' statuses
+	Atomic bool
+	// Path is the batch endpoint. Requests to any other path, or using a method other than POST, are passed to the next handler
+	// untouched, so endpoints which accept JSON arrays aren't affected. Default: /batch
+	Path string
+	// MaxBodySize is the largest batch body, in bytes, which is read. A larger batch gets a StatusRequestEntityTooLarge (413).
+	// Default: 1MB
+	MaxBodySize int64
+}
+
+// Batch middleware allows clients to send several requests in one.
+// A POST to /batch whose body is a JSON array of BatchRequests has each of them dispatched to the single handler,
+// and the BatchResponses are returned together as a JSON array. A body which isn't a batch gets a StatusBadRequest (400).
+// Each request's body is passed to the single handler as is, and its response body is returned as is if its JSON,
+// otherwise it's returned as a JSON string.
+// Batched requests share the batch request's context, so they run within the same transaction if there is one.
+// Any other request is passed on to the next handler.
+func Batch(single http.Handler) Middleware {
+	return BatchWithOptions(single, BatchOptions{})
+}
+
+// BatchWithOptions is Batch configured with the supplied BatchOptions, e.g. to fail the whole batch when one of its requests fails
+func BatchWithOptions(single http.Handler, options BatchOptions) Middleware {
+	if options.Path == "" {
+		options.Path = "/batch"
+	}
+	if options.MaxBodySize <= 0 {
+		options.MaxBodySize = 1 << 20
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			if r.Method != http.MethodPost || r.URL.Path != options.Path || r.Body == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body, err := ioutil.ReadAll(io.LimitReader(r.Body, options.MaxBodySize+1))
+			r.Body.Close()
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if int64(len(body)) > options.MaxBodySize {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			var batch []BatchRequest
+			if err := json.Unmarshal(body, &batch); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			status := http.StatusOK
+			responses := make([]BatchResponse, len(batch))
+			for i, br := range batch {
+				responses[i], err = serveBatchRequest(single, r, br)
+				if err != nil {
+					responses[i] = BatchResponse{Status: http.StatusBadRequest}
+				}
+				if options.Atomic && status == http.StatusOK && !isHTTPStatusOk(responses[i].Status) {
+					status = responses[i].Status
+				}
+			}
+
+			response, err := json.Marshal(responses)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			w.Write(response)
+		})
+	}
+}
+
+// serveBatchRequest builds a http request from the batched request & serves it using the handler
+func serveBatchRequest(handler http.Handler, parent *http.Request, br BatchRequest) (BatchResponse, error) {
+
+	req, err := http.NewRequest(br.Method, br.Path, bytes.NewReader(br.Body))
+	if err != nil {
+		return BatchResponse{}, err
+	}
+	req = req.WithContext(parent.Context())
+	req.Host = parent.Host
+	req.RemoteAddr = parent.RemoteAddr
+	for key, values := range br.Header {
+		req.Header[http.CanonicalHeaderKey(key)] = values
+	}
+
+	bw := &batchResponseWriter{header: http.Header{}}
+	handler.ServeHTTP(bw, req)
+
+	if bw.status == 0 {
+		bw.status = http.StatusOK
+	}
+	response := BatchResponse{Status: bw.status, Header: bw.header}
+	if bw.buf.Len() > 0 {
+		if json.Valid(bw.buf.Bytes()) {
+			response.Body = bw.buf.Bytes()
+		} else {
+			response.Body, err = json.Marshal(bw.buf.String())
+		}
+	}
+	return response, err
+}
+
+// batchResponseWriter implements the ResponseWriter interface to capture the response to a batched request
+type batchResponseWriter struct {
+	header http.Header
+	status int
+	buf    bytes.Buffer
+}
+
+// Header returns the batched request's response headers
+func (bw *batchResponseWriter) Header() http.Header {
+	return bw.header
+}
+
+// WriteHeader sets the batched request's response status
+func (bw *batchResponseWriter) WriteHeader(status int) {
+	if bw.status == 0 {
+		bw.status = status
+	}
+}
+
+// Write buffers the batched request's response body
+func (bw *batchResponseWriter) Write(b []byte) (int, error) {
+	if bw.status == 0 {
+		bw.status = http.StatusOK
+	}
+	return bw.buf.Write(b)
+}
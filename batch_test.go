@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// batchTestHandler responds with the requested path, or a StatusNotFound (404) for /missing
+var batchTestHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/missing" {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"path":"` + r.URL.Path + `"}`))
+})
+
+// TestBatchTwoRequests tests that each batched request is dispatched and the responses returned together
+func TestBatchTwoRequests(t *testing.T) {
+
+	// Arrange
+	body := `[{"method":"GET","path":"/a"},{"method":"GET","path":"/b"}]`
+	r, _ := http.NewRequest("POST", "/batch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler := Batch(batchTestHandler)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called for a batch")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	var responses []BatchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &responses); err != nil {
+		t.Fatalf("Expected a JSON array of responses but got %s", w.Body.String())
+	}
+	if len(responses) != 2 {
+		t.Fatalf("Expected 2 responses but got %v", len(responses))
+	}
+	if s := string(responses[0].Body); s != `{"path":"/a"}` {
+		t.Fatalf("Expected the first response to be for /a but was %s", s)
+	}
+	if s := string(responses[1].Body); s != `{"path":"/b"}` {
+		t.Fatalf("Expected the second response to be for /b but was %s", s)
+	}
+}
+
+// TestBatchMixedSuccessAndFailure tests that a failed batched request doesn't fail the batch
+func TestBatchMixedSuccessAndFailure(t *testing.T) {
+
+	// Arrange
+	body := `[{"method":"GET","path":"/a"},{"method":"GET","path":"/missing"}]`
+	r, _ := http.NewRequest("POST", "/batch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler := Batch(batchTestHandler)(http.NotFoundHandler())
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	var responses []BatchResponse
+	json.Unmarshal(w.Body.Bytes(), &responses)
+	if len(responses) != 2 {
+		t.Fatalf("Expected 2 responses but got %v", len(responses))
+	}
+	if responses[0].Status != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected for the first response but was %v", responses[0].Status)
+	}
+	if responses[1].Status != http.StatusNotFound {
+		t.Fatalf("StatusNotFound 404 expected for the second response but was %v", responses[1].Status)
+	}
+	if s := string(responses[1].Body); s != `"not found"` {
+		t.Fatalf("Expected a non JSON body to be returned as a JSON string but was %s", s)
+	}
+}
+
+// TestBatchAtomic tests that the batch fails with the status of a failed request when atomic
+func TestBatchAtomic(t *testing.T) {
+
+	// Arrange
+	body := `[{"method":"GET","path":"/a"},{"method":"GET","path":"/missing"}]`
+	r, _ := http.NewRequest("POST", "/batch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler := BatchWithOptions(batchTestHandler, BatchOptions{Atomic: true})(http.NotFoundHandler())
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("StatusNotFound 404 expected but was %v", w.Code)
+	}
+}
+
+// TestBatchNotABatch tests that requests to other paths, including JSON arrays, are passed to the next handler with their bodies intact
+func TestBatchNotABatch(t *testing.T) {
+
+	tests := []string{`{"name":"test"}`, `[{"method":"GET","path":"/a"}]`}
+
+	for _, test := range tests {
+
+		// Arrange
+		r, _ := http.NewRequest("POST", "/items", strings.NewReader(test))
+		w := httptest.NewRecorder()
+		handler := Batch(batchTestHandler)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			if string(body) != test {
+				t.Fatalf("Expected the request body %s to be readable but was %s", test, body)
+			}
+			w.WriteHeader(http.StatusCreated)
+		}))
+
+		// Act
+		handler.ServeHTTP(w, r)
+
+		// Assert
+		if w.Code != http.StatusCreated {
+			t.Fatalf("StatusCreated 201 expected for %s but was %v", test, w.Code)
+		}
+	}
+}
+
+// TestBatchWithOptionsPath tests that the batch endpoint can be configured
+func TestBatchWithOptionsPath(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/api/batch", strings.NewReader(`[{"method":"GET","path":"/a"}]`))
+	w := httptest.NewRecorder()
+	handler := BatchWithOptions(batchTestHandler, BatchOptions{Path: "/api/batch"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called for a batch")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
+
+// TestBatchMaxBodySize tests that a batch larger than MaxBodySize gets a StatusRequestEntityTooLarge (413)
+func TestBatchMaxBodySize(t *testing.T) {
+
+	// Arrange
+	body := `[{"method":"GET","path":"/a"},{"method":"GET","path":"/b"}]`
+	r, _ := http.NewRequest("POST", "/batch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler := BatchWithOptions(batchTestHandler, BatchOptions{MaxBodySize: int64(len(body) - 1)})(http.NotFoundHandler())
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("StatusRequestEntityTooLarge 413 expected but was %v", w.Code)
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+)
+
+// VerifyBodyHash middleware detects request bodies corrupted or tampered with in transit.
+// It compares the SHA-256 hash of the request body against the client supplied hash in the named header, e.g. X-Content-SHA256
+// The header's hash can be hex or base64 encoded. StatusBadRequest (400) is returned when the header is missing or the hashes don't match.
+// The body is buffered, so it remains readable by the next handler.
+func VerifyBodyHash(header string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			expected := decodeHash(r.Header.Get(header))
+			if expected == nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			var body []byte
+			if r.Body != nil {
+				var err error
+				body, err = ioutil.ReadAll(r.Body)
+				r.Body.Close()
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			}
+
+			actual := sha256.Sum256(body)
+			if subtle.ConstantTimeCompare(expected, actual[:]) != 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// decodeHash decodes the hex or base64 encoded SHA-256 hash, returning nil if it isn't one
+func decodeHash(encoded string) []byte {
+	if hash, err := hex.DecodeString(encoded); err == nil && len(hash) == sha256.Size {
+		return hash
+	}
+	if hash, err := base64.StdEncoding.DecodeString(encoded); err == nil && len(hash) == sha256.Size {
+		return hash
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestVerifyBodyHashMatch tests that the request is passed on, with a readable body, when the hashes match
+func TestVerifyBodyHashMatch(t *testing.T) {
+
+	// Arrange
+	body := `{"amount":100}`
+	hash := sha256.Sum256([]byte(body))
+	r, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Add("X-Content-SHA256", hex.EncodeToString(hash[:]))
+	w := httptest.NewRecorder()
+	handler := VerifyBodyHash("X-Content-SHA256")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if string(b) != body {
+			t.Fatalf("Expected the body to be readable but was %s", b)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
+
+// TestVerifyBodyHashBase64Match tests that a base64 encoded hash is accepted
+func TestVerifyBodyHashBase64Match(t *testing.T) {
+
+	// Arrange
+	body := `{"amount":100}`
+	hash := sha256.Sum256([]byte(body))
+	r, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Add("X-Content-SHA256", base64.StdEncoding.EncodeToString(hash[:]))
+	w := httptest.NewRecorder()
+	handler := VerifyBodyHash("X-Content-SHA256")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
+
+// TestVerifyBodyHashMismatch tests that StatusBadRequest is returned when the body doesn't match the hash
+func TestVerifyBodyHashMismatch(t *testing.T) {
+
+	// Arrange
+	hash := sha256.Sum256([]byte(`{"amount":100}`))
+	r, _ := http.NewRequest("POST", "/", strings.NewReader(`{"amount":1000}`))
+	r.Header.Add("X-Content-SHA256", hex.EncodeToString(hash[:]))
+	w := httptest.NewRecorder()
+	handler := VerifyBodyHash("X-Content-SHA256")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("StatusBadRequest 400 expected but was %v", w.Code)
+	}
+}
+
+// TestVerifyBodyHashMissingHeader tests that StatusBadRequest is returned when there is no hash header
+func TestVerifyBodyHashMissingHeader(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/", strings.NewReader(`{"amount":100}`))
+	w := httptest.NewRecorder()
+	handler := VerifyBodyHash("X-Content-SHA256")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("StatusBadRequest 400 expected but was %v", w.Code)
+	}
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+)
+
+// CancelHandler middleware responds with the supplied status when the request context is canceled,
+// because the client went away or a timeout expired, before the handler has written a response.
+// Cancellations are logged separately from server errors, so that client aborts aren't misattributed as 500s in metrics.
+// StatusClientClosedRequest (499) is a typical status to use
+func CancelHandler(status int) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			rw := NewResponseWriter(w)
+			next.ServeHTTP(rw, r)
+
+			if err := r.Context().Err(); err != nil && rw.Status() == 0 {
+				log.Printf("middleware: %s %s canceled before a response was written (%v), responding %d", r.Method, r.URL.Path, err, status)
+				w.WriteHeader(status)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestCancelHandlerCanceledContext tests that the configured status is written when the context is canceled during the handler
+func TestCancelHandlerCanceledContext(t *testing.T) {
+
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r, _ := http.NewRequest("GET", "/", nil)
+	r = r.WithContext(ctx)
+	w := httptest.NewRecorder()
+	handler := CancelHandler(StatusClientClosedRequest)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		<-r.Context().Done()
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != StatusClientClosedRequest {
+		t.Fatalf("StatusClientClosedRequest 499 expected but was %v", w.Code)
+	}
+}
+
+// TestCancelHandlerResponseWritten tests that a response written by the handler is kept when the context is canceled
+func TestCancelHandlerResponseWritten(t *testing.T) {
+
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r, _ := http.NewRequest("GET", "/", nil)
+	r = r.WithContext(ctx)
+	w := httptest.NewRecorder()
+	handler := CancelHandler(StatusClientClosedRequest)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		cancel()
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("StatusAccepted 202 expected but was %v", w.Code)
+	}
+}
+
+// TestCancelHandlerNotCanceled tests that requests which aren't canceled are unaffected
+func TestCancelHandlerNotCanceled(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler := CancelHandler(StatusClientClosedRequest)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
+
+// TestCancelHandlerStreams tests that the response is written straight through rather than buffered
+func TestCancelHandlerStreams(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	var written string
+	handler := CancelHandler(StatusClientClosedRequest)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("Test"))
+		written = w.Body.String()
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if written != "Test" {
+		t.Fatalf("Expected the body to be written before the handler returned but was %s", written)
+	}
+}
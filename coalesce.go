@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+)
+
+// CoalesceWrites middleware collapses concurrent identical idempotent writes into a single execution.
+// Requests are identical when keyFn returns the same key for them, e.g. an Idempotency-Key header or a hash of the method, path & body.
+// The key must also identify the caller, e.g. the authenticated subject, as every request with the key is sent the same response,
+// so a key shared between users would serve one user's response to another. keyFn should run after the auth middleware.
+// The first request runs the next handler while the others wait, & all of them are sent its buffered response.
+// If the first request's handler panics the others are sent a StatusInternalServerError (500).
+// Placed outside the Transaction middleware, only the first request's transaction is run, so its side effects are committed once.
+// Requests for which keyFn returns an empty key aren't coalesced
+func CoalesceWrites(keyFn func(*http.Request) string) Middleware {
+	return coalesceWrites(keyFn, nil)
+}
+
+// coalesceWrites is CoalesceWrites, calling onJoin, if set, when a request joins an in flight write
+func coalesceWrites(keyFn func(*http.Request) string, onJoin func()) Middleware {
+	var mu sync.Mutex
+	calls := map[string]*coalescedCall{}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := keyFn(r)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			mu.Lock()
+			call, inFlight := calls[key]
+			if !inFlight {
+				call = &coalescedCall{response: &batchResponseWriter{header: http.Header{}}}
+				call.wg.Add(1)
+				calls[key] = call
+			}
+			mu.Unlock()
+
+			if inFlight {
+				if onJoin != nil {
+					onJoin()
+				}
+				call.wg.Wait()
+				call.writeTo(w)
+				return
+			}
+
+			func() {
+				completed := false
+				defer func() {
+					mu.Lock()
+					delete(calls, key)
+					mu.Unlock()
+					if !completed {
+						// the handler panicked, so whatever it wrote is discarded rather than shared
+						call.response = &batchResponseWriter{header: http.Header{}, status: http.StatusInternalServerError}
+					}
+					call.wg.Done()
+				}()
+				next.ServeHTTP(call.response, r)
+				completed = true
+			}()
+			call.writeTo(w)
+		})
+	}
+}
+
+// coalescedCall is an in flight write whose response is shared by the identical requests waiting on it
+type coalescedCall struct {
+	wg       sync.WaitGroup
+	response *batchResponseWriter
+}
+
+// writeTo writes a copy of the shared response
+func (c *coalescedCall) writeTo(w http.ResponseWriter) {
+	for k, v := range c.response.header {
+		w.Header()[k] = append([]string(nil), v...)
+	}
+	status := c.response.status
+	if status == 0 {
+		// the handler didn't write anything, which net/http sends as a StatusOK (200)
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	w.Write(c.response.buf.Bytes())
+}
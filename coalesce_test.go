@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// coalesceTestKey keys requests on the caller & their Idempotency-Key
+func coalesceTestKey(r *http.Request) string {
+	return r.Header.Get("Authorization") + " " + r.Header.Get("Idempotency-Key")
+}
+
+// serveCoalesced serves n identical requests concurrently, releasing the first request's handler once the others
+// have joined its in flight write, & returns their responses
+func serveCoalesced(n int, release chan struct{}, handler func(joined *sync.WaitGroup) http.Handler) []*httptest.ResponseRecorder {
+	var joined sync.WaitGroup
+	joined.Add(n - 1)
+	h := handler(&joined)
+
+	recorders := make([]*httptest.ResponseRecorder, n)
+	var done sync.WaitGroup
+	for i := range recorders {
+		recorders[i] = httptest.NewRecorder()
+		done.Add(1)
+		go func(w *httptest.ResponseRecorder) {
+			defer done.Done()
+			defer func() {
+				// the first request's panic is propagated to its own caller
+				recover()
+			}()
+			r, _ := http.NewRequest("POST", "/orders", nil)
+			r.Header.Set("Authorization", "Bearer user-1")
+			r.Header.Set("Idempotency-Key", "order-1")
+			h.ServeHTTP(w, r)
+		}(recorders[i])
+	}
+	joined.Wait()
+	close(release)
+	done.Wait()
+	return recorders
+}
+
+// TestCoalesceWritesConcurrentIdenticalWrites tests that concurrent identical writes are executed once, committing a single transaction, & share its response
+func TestCoalesceWritesConcurrentIdenticalWrites(t *testing.T) {
+
+	// Arrange
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	release := make(chan struct{})
+	var executions int32
+	handler := func(joined *sync.WaitGroup) http.Handler {
+		return coalesceWrites(coalesceTestKey, joined.Done)(Transaction(db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&executions, 1)
+			<-release
+			w.Header().Set("Location", "/orders/1")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id":1}`))
+		})))
+	}
+
+	// Act
+	recorders := serveCoalesced(5, release, handler)
+
+	// Assert
+	if n := atomic.LoadInt32(&executions); n != 1 {
+		t.Fatalf("Expected the write to be executed once but was executed %v times", n)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expected a single committed transaction: %v", err)
+	}
+	for _, w := range recorders {
+		if w.Code != http.StatusCreated {
+			t.Fatalf("StatusCreated 201 expected but was %v", w.Code)
+		}
+		if body := w.Body.String(); body != `{"id":1}` {
+			t.Fatalf("Expected the shared response body but was %v", body)
+		}
+		if location := w.Header().Get("Location"); location != "/orders/1" {
+			t.Fatalf("Expected the shared Location header but was %v", location)
+		}
+	}
+}
+
+// TestCoalesceWritesPanic tests that the waiting requests are sent a StatusInternalServerError (500) when the handler panics,
+// rather than the partial response it wrote
+func TestCoalesceWritesPanic(t *testing.T) {
+
+	// Arrange
+	release := make(chan struct{})
+	handler := func(joined *sync.WaitGroup) http.Handler {
+		return coalesceWrites(coalesceTestKey, joined.Done)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id":`))
+			panic("Handler failed")
+		}))
+	}
+
+	// Act
+	recorders := serveCoalesced(3, release, handler)
+
+	// Assert
+	waiting := 0
+	for _, w := range recorders {
+		if w.Code == http.StatusInternalServerError && w.Body.Len() == 0 {
+			waiting++
+		}
+	}
+	if waiting != 2 {
+		t.Fatalf("Expected the 2 waiting requests to be sent a StatusInternalServerError 500 but were %v", waiting)
+	}
+}
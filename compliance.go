@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+)
+
+// ComplianceRecord is the audit record of a request logged by ComplianceLog.
+// The metadata is always present, the bodies only for sampled requests
+type ComplianceRecord struct {
+	Subject      string
+	Method       string
+	Path         string
+	Status       int
+	Sampled      bool
+	RequestBody  []byte
+	ResponseBody []byte
+}
+
+// ComplianceOptions defines the user supplied ComplianceLog configuration options.
+type ComplianceOptions struct {
+	// Sink receives a record for every request. Required
+	Sink func(ComplianceRecord)
+	// SampleRate is the fraction, between 0 and 1, of requests whose bodies are logged. Default: 0, metadata only
+	SampleRate float64
+	// RedactFields are the JSON fields, matched case insensitively at any depth, whose values are redacted from logged bodies.
+	// Bodies which aren't JSON, or were truncated, can't be redacted, so aren't logged when fields are set
+	RedactFields []string
+	// MaxBodySize is the number of bytes of each body captured for logging, anything larger is truncated.
+	// Only this much of each body is held in memory, the rest passes straight through. Default: 64KB
+	MaxBodySize int
+	// Subject gets the authenticated subject of the request. Default: the sub claim set by JWT
+	Subject func(ctx context.Context) string
+}
+
+// redacted replaces the values of redacted fields
+const redacted = "[REDACTED]"
+
+// ComplianceLog middleware logs an audit record of every request to the compliance sink.
+// The subject, method, path & status are always logged, including when the handler panics, while the redacted request
+// & response bodies are logged for a sampled fraction of requests. Bodies are captured as the handler reads & writes them,
+// so the request body is only the part the handler read.
+// It should be chained after the auth middleware, so the subject is known
+func ComplianceLog(opts ComplianceOptions) Middleware {
+	if opts.Sink == nil {
+		panic("ComplianceLog requires a Sink")
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 64 * 1024
+	}
+	if opts.Subject == nil {
+		opts.Subject = claimsSubject
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			record := ComplianceRecord{
+				Subject: opts.Subject(r.Context()),
+				Method:  r.Method,
+				Path:    r.URL.Path,
+				Sampled: opts.SampleRate > 0 && rand.Float64() < opts.SampleRate,
+			}
+
+			// the response is always passed straight through, so streaming & Flush work whether or not it's sampled
+			sw := &statusWriter{rw: w, buf: bytes.NewBuffer(nil), streamOnStatus: alwaysStream}
+			var rw http.ResponseWriter = sw
+			var requestBody, responseBody *limitedBuffer
+			if record.Sampled {
+				// only the first MaxBodySize bytes of each body are captured as they pass through
+				requestBody = &limitedBuffer{limit: opts.MaxBodySize}
+				responseBody = &limitedBuffer{limit: opts.MaxBodySize}
+				if r.Body != nil {
+					r.Body = struct {
+						io.Reader
+						io.Closer
+					}{io.TeeReader(r.Body, requestBody), r.Body}
+				}
+				rw = &teeWriter{statusWriter: sw, capture: responseBody}
+			}
+
+			// the record is logged even if the handler panics
+			defer func() {
+				rec := recover()
+				record.Status = sw.Status()
+				if record.Status == 0 && rec != nil {
+					record.Status = http.StatusInternalServerError
+				} else if record.Status == 0 {
+					record.Status = http.StatusOK
+				}
+				if record.Sampled {
+					record.RequestBody = opts.redactBody(r.Header, requestBody.Bytes())
+					record.ResponseBody = opts.redactBody(w.Header(), responseBody.Bytes())
+				}
+				opts.Sink(record)
+				if rec != nil {
+					panic(rec)
+				}
+			}()
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// limitedBuffer is a bytes.Buffer which keeps only the first limit bytes written to it, discarding the rest
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+// Write buffers as much of b as fits within the limit. It never fails, so it can be used with io.TeeReader
+func (lb *limitedBuffer) Write(b []byte) (int, error) {
+	if space := lb.limit - lb.Len(); space > 0 {
+		if len(b) > space {
+			lb.Buffer.Write(b[:space])
+		} else {
+			lb.Buffer.Write(b)
+		}
+	}
+	return len(b), nil
+}
+
+// teeWriter is a statusWriter which captures the response body as it's written
+type teeWriter struct {
+	*statusWriter
+	capture io.Writer
+}
+
+// Write captures the bytes & writes them to the statusWriter
+func (tw *teeWriter) Write(b []byte) (int, error) {
+	tw.capture.Write(b)
+	return tw.statusWriter.Write(b)
+}
+
+// redactBody redacts & truncates the body to be logged
+func (opts ComplianceOptions) redactBody(header http.Header, body []byte) []byte {
+	if len(body) == 0 {
+		return nil
+	}
+	if len(opts.RedactFields) > 0 {
+		if !isJSON(header) {
+			return nil
+		}
+		var value interface{}
+		if err := json.Unmarshal(body, &value); err != nil {
+			return nil
+		}
+		var err error
+		body, err = json.Marshal(redactValue(value, opts.RedactFields))
+		if err != nil {
+			return nil
+		}
+	}
+	if len(body) > opts.MaxBodySize {
+		body = body[:opts.MaxBodySize]
+	}
+	logged := make([]byte, len(body))
+	copy(logged, body)
+	return logged
+}
+
+// redactValue replaces the values of the fields, at any depth, of the decoded JSON value
+func redactValue(value interface{}, fields []string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if containsFold(fields, key) {
+				v[key] = redacted
+			} else {
+				v[key] = redactValue(field, fields)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item, fields)
+		}
+	}
+	return value
+}
+
+// claimsSubject gets the sub claim set by the JWT middleware, or "" if there isn't one
+func claimsSubject(ctx context.Context) string {
+	sub, _ := GetClaims(ctx)["sub"].(string)
+	return sub
+}
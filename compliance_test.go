@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// TestComplianceLogSampledRedacted tests that sampled requests log their bodies with the fields redacted
+func TestComplianceLogSampledRedacted(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/payments", strings.NewReader(`{"amount":10,"card":{"number":"4111111111111111"}}`))
+	r.Header.Set("Content-Type", "application/json")
+	r = r.WithContext(setClaims(r.Context(), jwt.MapClaims{"sub": "user-1"}))
+	w := httptest.NewRecorder()
+	var record ComplianceRecord
+	options := ComplianceOptions{
+		Sink:         func(r ComplianceRecord) { record = r },
+		SampleRate:   1,
+		RedactFields: []string{"Number", "token"},
+	}
+	handler := ComplianceLog(options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !strings.Contains(string(body), "4111111111111111") {
+			t.Fatalf("Expected the next handler to receive the unredacted body but was %s", body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":1,"token":"abc"}`))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusCreated || w.Body.String() != `{"id":1,"token":"abc"}` {
+		t.Fatalf("Expected the response to be written unredacted but was %v %s", w.Code, w.Body.String())
+	}
+	if !record.Sampled || record.Subject != "user-1" || record.Status != http.StatusCreated || record.Path != "/payments" {
+		t.Fatalf("Expected the sampled metadata to be logged but was %+v", record)
+	}
+	if s := string(record.RequestBody); s != `{"amount":10,"card":{"number":"[REDACTED]"}}` {
+		t.Fatalf("Expected the logged request body to be redacted but was %s", s)
+	}
+	if s := string(record.ResponseBody); s != `{"id":1,"token":"[REDACTED]"}` {
+		t.Fatalf("Expected the logged response body to be redacted but was %s", s)
+	}
+}
+
+// TestComplianceLogUnsampledMetadata tests that the metadata, but not the bodies, is logged for requests which aren't sampled
+func TestComplianceLogUnsampledMetadata(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/payments", strings.NewReader(`{"amount":10}`))
+	r = r.WithContext(setClaims(r.Context(), jwt.MapClaims{"sub": "user-1"}))
+	w := httptest.NewRecorder()
+	var records []ComplianceRecord
+	handler := ComplianceLog(ComplianceOptions{Sink: func(r ComplianceRecord) { records = append(records, r) }})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"id":1}`))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusAccepted || w.Body.String() != `{"id":1}` {
+		t.Fatalf("Expected the response to be passed through but was %v %s", w.Code, w.Body.String())
+	}
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record to be logged but was %v", len(records))
+	}
+	record := records[0]
+	if record.Sampled || record.Subject != "user-1" || record.Method != "POST" || record.Path != "/payments" || record.Status != http.StatusAccepted {
+		t.Fatalf("Expected the metadata to be logged but was %+v", record)
+	}
+	if record.RequestBody != nil || record.ResponseBody != nil {
+		t.Fatalf("Expected the bodies not to be logged but were %s & %s", record.RequestBody, record.ResponseBody)
+	}
+}
+
+// TestComplianceLogMaxBodySize tests that only MaxBodySize bytes of each sampled body are captured,
+// while the full bodies pass through & flushes reach the client
+func TestComplianceLogMaxBodySize(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/upload", strings.NewReader("0123456789"))
+	w := httptest.NewRecorder()
+	var record ComplianceRecord
+	handler := ComplianceLog(ComplianceOptions{Sink: func(r ComplianceRecord) { record = r }, SampleRate: 1, MaxBodySize: 4})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != "0123456789" {
+			t.Fatalf("Expected the next handler to receive the whole body but was %s", body)
+		}
+		w.Write([]byte("abcdef"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("ghij"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Body.String() != "abcdefghij" || !w.Flushed {
+		t.Fatalf("Expected the whole response to be streamed but was %s, flushed %v", w.Body.String(), w.Flushed)
+	}
+	if string(record.RequestBody) != "0123" || string(record.ResponseBody) != "abcd" {
+		t.Fatalf("Expected the logged bodies to be truncated but were %s & %s", record.RequestBody, record.ResponseBody)
+	}
+}
+
+// TestComplianceLogPanic tests that a record is logged when the handler panics
+func TestComplianceLogPanic(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/payments", nil)
+	w := httptest.NewRecorder()
+	var records []ComplianceRecord
+	handler := ComplianceLog(ComplianceOptions{Sink: func(r ComplianceRecord) { records = append(records, r) }})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("Handler failed")
+	}))
+	defer func() {
+		// Assert
+		if recover() == nil {
+			t.Fatal("Expected the panic to be propagated")
+		}
+		if len(records) != 1 || records[0].Status != http.StatusInternalServerError || records[0].Path != "/payments" {
+			t.Fatalf("Expected a StatusInternalServerError 500 record to be logged but was %+v", records)
+		}
+	}()
+
+	// Act
+	handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions defines the user supplied CORS configuration options.
+type CORSOptions struct {
+	// AllowedOrigins are the origins, e.g. https://app.example.com, allowed to make cross origin requests.
+	// "*" allows any origin
+	AllowedOrigins []string
+	// AllowedMethods are the methods allowed in preflighted requests. Default: GET, HEAD & POST
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed in preflighted requests
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers, beyond the CORS safelisted ones, the browser exposes to the client
+	ExposedHeaders []string
+	// AllowCredentials allows requests with cookies & HTTP authentication.
+	// The allowed origin is then always reflected, as browsers reject "*" with credentials
+	AllowCredentials bool
+	// MaxAge is how long the browser may cache the preflight response. Default: 0, not cached
+	MaxAge time.Duration
+}
+
+// CORS middleware handles Cross-Origin Resource Sharing, allowing browsers on the allowed origins to call the handler.
+// Preflight OPTIONS requests are answered with the allowed methods & headers & a StatusNoContent (204) without calling the next handler.
+// Actual requests are given the Access-Control-Allow-Origin header. Requests from other origins get no CORS headers,
+// so the browser blocks them, with preflight requests answered with a StatusForbidden (403)
+func CORS(opts CORSOptions) Middleware {
+	if len(opts.AllowedMethods) == 0 {
+		opts.AllowedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+	anyOrigin := containsString(opts.AllowedOrigins, "*")
+	allowedMethods := strings.Join(opts.AllowedMethods, ", ")
+	allowedHeaders := strings.Join(opts.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(opts.ExposedHeaders, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			w.Header().Add("Vary", "Origin")
+			if !anyOrigin && !containsString(opts.AllowedOrigins, origin) {
+				if preflight {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if anyOrigin && !opts.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			if opts.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if preflight {
+				w.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+				if allowedHeaders != "" {
+					w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
+				}
+				if opts.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.FormatInt(int64(opts.MaxAge/time.Second), 10))
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if exposedHeaders != "" {
+				w.Header().Set("Access-Control-Expose-Headers", exposedHeaders)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// corsOptions are the CORS options used by the tests
+var corsOptions = CORSOptions{
+	AllowedOrigins: []string{"https://app.example.com"},
+	AllowedMethods: []string{"GET", "PUT", "DELETE"},
+	AllowedHeaders: []string{"Authorization", "Content-Type"},
+	MaxAge:         10 * time.Minute,
+}
+
+// TestCORSPreflight tests that a preflight request is answered with the allowed methods & headers without calling the next handler
+func TestCORSPreflight(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("OPTIONS", "/users/1", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	r.Header.Set("Access-Control-Request-Method", "PUT")
+	w := httptest.NewRecorder()
+	handler := CORS(corsOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("StatusNoContent 204 expected but was %v", w.Code)
+	}
+	expected := map[string]string{
+		"Access-Control-Allow-Origin":  "https://app.example.com",
+		"Access-Control-Allow-Methods": "GET, PUT, DELETE",
+		"Access-Control-Allow-Headers": "Authorization, Content-Type",
+		"Access-Control-Max-Age":       "600",
+	}
+	for header, value := range expected {
+		if h := w.Header().Get(header); h != value {
+			t.Fatalf("Expected the %s header %s but was %s", header, value, h)
+		}
+	}
+}
+
+// TestCORSDisallowedOrigin tests that requests from an origin which isn't allowed get no CORS headers
+func TestCORSDisallowedOrigin(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/users/1", nil)
+	r.Header.Set("Origin", "https://evil.example.com")
+	w := httptest.NewRecorder()
+	handler := CORS(corsOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if h := w.Header().Get("Access-Control-Allow-Origin"); h != "" {
+		t.Fatalf("Expected no Access-Control-Allow-Origin header but was %s", h)
+	}
+}
+
+// TestCORSDisallowedOriginPreflight tests that a preflight request from an origin which isn't allowed is forbidden
+func TestCORSDisallowedOriginPreflight(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("OPTIONS", "/users/1", nil)
+	r.Header.Set("Origin", "https://evil.example.com")
+	r.Header.Set("Access-Control-Request-Method", "DELETE")
+	w := httptest.NewRecorder()
+	handler := CORS(corsOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("StatusForbidden 403 expected but was %v", w.Code)
+	}
+	if h := w.Header().Get("Access-Control-Allow-Methods"); h != "" {
+		t.Fatalf("Expected no Access-Control-Allow-Methods header but was %s", h)
+	}
+}
+
+// TestCORSCredentials tests that with credentials the origin is reflected, rather than "*", for a simple request
+func TestCORSCredentials(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/users/1", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	options := CORSOptions{AllowedOrigins: []string{"*"}, AllowCredentials: true}
+	handler := CORS(options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	if h := w.Header().Get("Access-Control-Allow-Origin"); h != "https://app.example.com" {
+		t.Fatalf("Expected the origin to be reflected in the Access-Control-Allow-Origin header but was %s", h)
+	}
+	if h := w.Header().Get("Access-Control-Allow-Credentials"); h != "true" {
+		t.Fatalf("Expected the Access-Control-Allow-Credentials header true but was %s", h)
+	}
+	if h := w.Header().Get("Vary"); h != "Origin" {
+		t.Fatalf("Expected the Vary header Origin but was %s", h)
+	}
+}
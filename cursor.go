@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// CursorEmbed middleware adds a next_cursor field to JSON responses, so clients can read
+// the pagination cursor from the response body rather than only from headers.
+// nextFn is called once the wrapped handler has finished and reports the next cursor, if there is one.
+// JSON objects have a next_cursor field added. JSON arrays are always wrapped as {"data": [...], "next_cursor": "..."},
+// with next_cursor omitted on the last page, so clients see the same shape whether or not there is a next cursor.
+// Only successful (2xx) JSON responses are modified, everything else is written unchanged.
+func CursorEmbed(nextFn func(*http.Request) (string, bool)) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			sw := &statusWriter{rw: w, buf: bytes.NewBuffer(nil)}
+			next.ServeHTTP(sw, r)
+
+			if isHTTPStatusOk(sw.status) && isJSON(w.Header()) {
+				cursor, ok := nextFn(r)
+				body, err := embedCursor(sw.buf.Bytes(), cursor, ok)
+				if err == nil && body != nil {
+					sw.buf = bytes.NewBuffer(body)
+					w.Header().Del("Content-Length")
+				}
+			}
+
+			sw.Finish()
+		})
+	}
+}
+
+// embedCursor adds the cursor to the JSON body. A nil body is returned when the body doesn't need changing
+func embedCursor(body []byte, cursor string, hasCursor bool) ([]byte, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, errors.New("empty JSON body")
+	}
+
+	switch body[0] {
+	case '{':
+		if !hasCursor {
+			return nil, nil
+		}
+		fields := map[string]json.RawMessage{}
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return nil, err
+		}
+		encodedCursor, err := json.Marshal(cursor)
+		if err != nil {
+			return nil, err
+		}
+		fields["next_cursor"] = encodedCursor
+		return json.Marshal(fields)
+	case '[':
+		var data []json.RawMessage
+		if err := json.Unmarshal(body, &data); err != nil {
+			return nil, err
+		}
+		wrapped := struct {
+			Data       []json.RawMessage `json:"data"`
+			NextCursor *string           `json:"next_cursor,omitempty"`
+		}{Data: data}
+		if hasCursor {
+			wrapped.NextCursor = &cursor
+		}
+		return json.Marshal(wrapped)
+	}
+	return nil, errors.New("JSON body must be an array or object")
+}
@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestCursorEmbedAddsNextCursor tests that next_cursor is added to a JSON object when there is a next cursor
+func TestCursorEmbedAddsNextCursor(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/items", nil)
+	w := httptest.NewRecorder()
+	nextFn := func(r *http.Request) (string, bool) {
+		return "abc123", true
+	}
+	handler := CursorEmbed(nextFn)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"items":[1,2,3]}`))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	body := map[string]interface{}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected a JSON body but got %s", w.Body.String())
+	}
+	if body["next_cursor"] != "abc123" {
+		t.Fatalf("Expected next_cursor to be abc123 but was %v", body["next_cursor"])
+	}
+	if _, ok := body["items"]; !ok {
+		t.Fatal("Expected the handler's items field to be kept")
+	}
+}
+
+// TestCursorEmbedNoNextCursor tests that the body is unchanged when there is no next cursor
+func TestCursorEmbedNoNextCursor(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/items", nil)
+	w := httptest.NewRecorder()
+	nextFn := func(r *http.Request) (string, bool) {
+		return "", false
+	}
+	handler := CursorEmbed(nextFn)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"items":[1,2,3]}`))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if s := w.Body.String(); s != `{"items":[1,2,3]}` {
+		t.Fatalf("Expected an unchanged body but was %s", s)
+	}
+}
+
+// TestCursorEmbedArray tests that a JSON array is wrapped in an object alongside next_cursor
+func TestCursorEmbedArray(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/items", nil)
+	w := httptest.NewRecorder()
+	nextFn := func(r *http.Request) (string, bool) {
+		return "abc123", true
+	}
+	handler := CursorEmbed(nextFn)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(`[1,2,3]`))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if s := w.Body.String(); s != `{"data":[1,2,3],"next_cursor":"abc123"}` {
+		t.Fatalf("Expected the array to be wrapped but was %s", s)
+	}
+}
+
+// TestCursorEmbedArrayNoNextCursor tests that a JSON array is still wrapped on the last page, without a next_cursor
+func TestCursorEmbedArrayNoNextCursor(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/items", nil)
+	w := httptest.NewRecorder()
+	nextFn := func(r *http.Request) (string, bool) {
+		return "", false
+	}
+	handler := CursorEmbed(nextFn)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[1,2,3]`))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if s := w.Body.String(); s != `{"data":[1,2,3]}` {
+		t.Fatalf("Expected the array to be wrapped but was %s", s)
+	}
+}
+
+// TestCursorEmbedNotJSON tests that non JSON responses are left untouched
+func TestCursorEmbedNotJSON(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/items", nil)
+	w := httptest.NewRecorder()
+	nextFn := func(r *http.Request) (string, bool) {
+		return "abc123", true
+	}
+	handler := CursorEmbed(nextFn)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("Test"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if s := w.Body.String(); s != "Test" {
+		t.Fatalf("Expected an unchanged body but was %s", s)
+	}
+}
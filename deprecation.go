@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DeprecationOptions defines the user supplied Deprecation configuration options.
+type DeprecationOptions struct {
+	// Date the endpoint was deprecated. Default: the Deprecation header is set to true
+	Date time.Time
+	// Sunset is the date the endpoint will stop responding. Default: no Sunset header
+	Sunset time.Time
+	// Link to documentation on migrating away from the endpoint. Default: no Link header
+	Link string
+	// Message is the human readable Warning sent with the response. Default: "Deprecated API"
+	Message string
+}
+
+// Deprecation middleware marks responses from endpoints being phased out, so clients get machine readable notice.
+// It sets the Deprecation header (RFC 9745), the Sunset header (RFC 8594), a Link to the migration documentation
+// and a Warning header with a human readable message.
+func Deprecation(options DeprecationOptions) Middleware {
+
+	deprecation := "true"
+	if !options.Date.IsZero() {
+		deprecation = "@" + strconv.FormatInt(options.Date.Unix(), 10)
+	}
+	if options.Message == "" {
+		options.Message = "Deprecated API"
+	}
+	warning := "299 - " + strconv.Quote(options.Message)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := w.Header()
+			header.Set("Deprecation", deprecation)
+			if !options.Sunset.IsZero() {
+				header.Set("Sunset", options.Sunset.UTC().Format(http.TimeFormat))
+			}
+			if options.Link != "" {
+				header.Add("Link", "<"+options.Link+">; rel=\"deprecation\"")
+			}
+			header.Add("Warning", warning)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestDeprecationHeaders tests that the Deprecation, Sunset, Link & Warning headers are set with correctly formatted dates
+func TestDeprecationHeaders(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/v1/items", nil)
+	w := httptest.NewRecorder()
+	options := DeprecationOptions{
+		Date:    time.Date(2023, time.June, 30, 23, 59, 59, 0, time.UTC),
+		Sunset:  time.Date(2024, time.January, 1, 0, 0, 0, 0, time.FixedZone("IST", 3600)),
+		Link:    "https://example.com/docs/migrate-to-v2",
+		Message: "Use /v2/items",
+	}
+	handler := Deprecation(options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	if h := w.Header().Get("Deprecation"); h != "@1688169599" {
+		t.Fatalf("Expected Deprecation header @1688169599 but was %s", h)
+	}
+	if h := w.Header().Get("Sunset"); h != "Sun, 31 Dec 2023 23:00:00 GMT" {
+		t.Fatalf("Expected Sunset header Sun, 31 Dec 2023 23:00:00 GMT but was %s", h)
+	}
+	if h := w.Header().Get("Link"); h != "<https://example.com/docs/migrate-to-v2>; rel=\"deprecation\"" {
+		t.Fatalf("Expected Link header to the migration docs but was %s", h)
+	}
+	if h := w.Header().Get("Warning"); h != "299 - \"Use /v2/items\"" {
+		t.Fatalf("Expected Warning header but was %s", h)
+	}
+}
+
+// TestDeprecationDefaults tests the headers set when only the defaults are used
+func TestDeprecationDefaults(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/v1/items", nil)
+	w := httptest.NewRecorder()
+	handler := Deprecation(DeprecationOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if h := w.Header().Get("Deprecation"); h != "true" {
+		t.Fatalf("Expected Deprecation header true but was %s", h)
+	}
+	if h := w.Header().Get("Sunset"); h != "" {
+		t.Fatalf("Expected no Sunset header but was %s", h)
+	}
+	if h := w.Header().Get("Warning"); h != "299 - \"Deprecated API\"" {
+		t.Fatalf("Expected default Warning header but was %s", h)
+	}
+}
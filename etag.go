@@ -2,42 +2,126 @@ package middleware
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/base64"
 	"fmt"
 	"hash"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
 // DefaultEtag middleware which uses MD5 as its hashing function
 func DefaultEtag(next http.Handler) http.Handler {
-	return Etag(md5.New)(next)
+	return EtagWithOptions(EtagOptions{})(next)
+}
+
+// EtagOptions defines the user supplied Etag configuration options.
+type EtagOptions struct {
+	// Hash creates the hash used to generate the ETag from the response body. Default: MD5
+	Hash func() hash.Hash
+	// Methods are the request methods given ETags, requests using other methods pass straight through without buffering.
+	// Default: GET & HEAD, as conditional requests only apply to safe methods
+	Methods []string
+	// MaxSize is the number of response bytes buffered to generate the ETag. Once a response grows past MaxSize
+	// the buffer is flushed, the rest of the response is streamed & no ETag is generated. Default: 0, no limit
+	MaxSize int64
+	// Strong generates strong ETags, without the W/ prefix, e.g. for CDNs & range requests which require them.
+	// Default: false, weak ETags are generated
+	Strong bool
+	// CurrentETag gets the current ETag of the requested resource, e.g. from its stored version, or "" if it doesn't exist.
+	// When set, If-Match is evaluated before the next handler is called, for every method, so a StatusPreconditionFailed (412)
+	// stops a PUT, PATCH or DELETE of a stale version before it has any effect. An error returns a StatusInternalServerError (500).
+	// Default: nil, If-Match is evaluated against the generated ETag once the handler has run, which can't protect writes
+	CurrentETag func(r *http.Request) (string, error)
 }
 
 // Etag middleware which handles adding an ETag header to the response
 // An ETag is a hash of a resource that client's/browser use to cache resourse that are unchanged.
 // It allows the server to skip sending the resource over the object if the client has it already
 // A StatusNotModified (304) is returned when the client's resource is up to date.
-// Client's set the If-None-Match header to send their cached ETag for a resource
+// Client's set the If-None-Match header to send their cached ETags for a resource
+// A StatusPreconditionFailed (412) is returned, without the body, when the If-Match header doesn't match the ETag.
+// Either header can be * to match any ETag. If-Match is evaluated after the handler has run, so it can't stop a write,
+// use EtagOptions.CurrentETag to evaluate it beforehand
+// An ETag set by the handler is respected rather than generated from the body.
+// The request headers listed in the response's Vary header are included in the ETag, so each representation gets its own.
+// ETags are only generated, & conditional headers only evaluated, for successful (2xx) responses with a body.
+// Any other response, e.g. a 4xx or 5xx, is written exactly as the handler wrote it
+// Only GET & HEAD requests are given ETags
 func Etag(newHash func() hash.Hash) Middleware {
+	return EtagWithOptions(EtagOptions{Hash: newHash})
+}
+
+// EtagWithOptions middleware handles adding an ETag header to the response, like Etag, configured with the supplied EtagOptions
+func EtagWithOptions(opts EtagOptions) Middleware {
+	if opts.Hash == nil {
+		opts.Hash = md5.New
+	}
+	if len(opts.Methods) == 0 {
+		opts.Methods = []string{http.MethodGet, http.MethodHead}
+	}
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-			hash := newHash()
-			etagWriter := &etagWriter{rw: w, hash: hash, buf: bytes.NewBuffer(nil)}
+			ifMatch := r.Header.Get("If-Match")
+			if opts.CurrentETag != nil && ifMatch != "" {
+				currentEtag, err := opts.CurrentETag(r)
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				// If-Match * only matches when the resource exists
+				if currentEtag == "" || !matchesAny(ifMatch, currentEtag, strongMatch) {
+					w.WriteHeader(http.StatusPreconditionFailed)
+					return
+				}
+				// the precondition has been checked, so isn't evaluated again against the generated ETag
+				ifMatch = ""
+			}
+
+			if !containsString(opts.Methods, r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			hash := opts.Hash()
+			etagWriter := &etagWriter{rw: w, hash: hash, buf: bytes.NewBuffer(nil), maxSize: opts.MaxSize}
 			next.ServeHTTP(etagWriter, r)
 
+			if etagWriter.streaming {
+				return
+			}
+
 			if !isHTTPStatusOk(etagWriter.status) || etagWriter.status == http.StatusNoContent || etagWriter.buf.Len() == 0 {
 				etagWriter.writeResponse()
 				return
 			}
 
-			reqEtag := r.Header.Get("If-None-Match")
-			responseEtag := etagWriter.etag()
-			w.Header().Set("Etag", responseEtag)
+			// an ETag set by the handler, e.g. from a stored version, is used as is
+			responseEtag := w.Header().Get("Etag")
+			if responseEtag == "" {
+				// distinct representations of the resource, e.g. by Accept-Language, get distinct ETags
+				etagWriter.hash.Write([]byte(varyKey(w.Header(), r)))
+				responseEtag = etagWriter.etag(opts.Strong)
+				w.Header().Set("Etag", responseEtag)
+			}
+			if holder, ok := r.Context().Value(etagKey).(*etagHolder); ok {
+				holder.etag = responseEtag
+			}
+
+			if ifMatch != "" && !matchesAny(ifMatch, responseEtag, strongMatch) {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
 
-			if responseEtag == reqEtag {
+			if matchesAny(r.Header.Get("If-None-Match"), responseEtag, weakMatch) {
+				// the handler's Cache-Control, Content-Location, Date, Expires & Vary headers are kept, as RFC 7232 requires,
+				// while the metadata describing the omitted body is dropped
+				for _, header := range notModifiedExcludedHeaders {
+					w.Header().Del(header)
+				}
 				w.WriteHeader(http.StatusNotModified)
 				w.Write(nil)
 			} else {
@@ -47,14 +131,42 @@ func Etag(newHash func() hash.Hash) Middleware {
 	}
 }
 
+// etag context key
+var etagKey = &contextKey{"ETag"}
+
+// etagHolder receives the ETag computed by the Etag middleware
+type etagHolder struct {
+	etag string
+}
+
+// WithETag prepares the context to receive the ETag computed by an Etag middleware further down the chain,
+// so that outer middleware, e.g. logging or caching, can read it with GetETag once the next handler returns
+func WithETag(ctx context.Context) context.Context {
+	return context.WithValue(ctx, etagKey, &etagHolder{})
+}
+
+// GetETag gets the ETag computed for the response, or "" if the context wasn't prepared with WithETag or no ETag was computed
+func GetETag(ctx context.Context) string {
+	holder, ok := ctx.Value(etagKey).(*etagHolder)
+	if !ok {
+		return ""
+	}
+	return holder.etag
+}
+
+// notModifiedExcludedHeaders are the headers describing the body, which are removed from a StatusNotModified (304) response
+var notModifiedExcludedHeaders = []string{"Content-Type", "Content-Length", "Content-Encoding", "Content-Range", "Transfer-Encoding"}
+
 // etagWriter is an stuct which implements the ResponseWriter interface
 // Its responsible for capturing whats written the response & hashing it
 // so that it can be used as an etag header
 type etagWriter struct {
-	rw     http.ResponseWriter
-	hash   hash.Hash
-	buf    *bytes.Buffer
-	status int
+	rw        http.ResponseWriter
+	hash      hash.Hash
+	buf       *bytes.Buffer
+	status    int
+	maxSize   int64 // number of bytes buffered before streaming, 0 for no limit
+	streaming bool
 }
 
 // Header delegates to the http response Header
@@ -62,25 +174,50 @@ func (w etagWriter) Header() http.Header {
 	return w.rw.Header()
 }
 
-// WriteHeader sets the status of this writer to be set in the http response later
+// WriteHeader sets the status of this writer to be set in the http response later.
+// Like http.ResponseWriter only the first call is honoured. Informational (1xx) statuses are written straight through
 func (w *etagWriter) WriteHeader(status int) {
+	if isInformationalStatus(status) {
+		w.rw.WriteHeader(status)
+		return
+	}
+	if w.status != 0 {
+		return
+	}
 	w.status = status
 }
 
-// Write the bytes to both the buffer & the hash
+// Write the bytes to both the buffer & the hash.
+// Once the buffered body would grow past maxSize the buffer is flushed & writes go straight to the ResponseWriter
 func (w *etagWriter) Write(b []byte) (int, error) {
 	if w.status == 0 {
 		w.status = http.StatusOK
 	}
+	if w.streaming {
+		return w.rw.Write(b)
+	}
+	if w.maxSize > 0 && int64(w.buf.Len()+len(b)) > w.maxSize {
+		w.streaming = true
+		w.writeResponse()
+		return w.rw.Write(b)
+	}
 	w.buf.Write(b)
+	if w.rw.Header().Get("Etag") != "" {
+		// the handler set its own ETag, so there's no need to hash the body
+		return len(b), nil
+	}
 	l, err := w.hash.Write(b)
 	return l, err
 }
 
-// writeResponse writes the buffer to the response
+// writeResponse writes the status, if the handler wrote one, & the buffer to the response
 func (w *etagWriter) writeResponse() {
-	w.rw.WriteHeader(w.status)
-	w.rw.Write(w.buf.Bytes())
+	if w.status != 0 {
+		w.rw.WriteHeader(w.status)
+	}
+	if w.buf.Len() > 0 {
+		w.rw.Write(w.buf.Bytes())
+	}
 }
 
 // sumHash finishes & returns the hashed response
@@ -89,9 +226,57 @@ func (w *etagWriter) sumHash() []byte {
 }
 
 // etag outputs etag for the response, which contains the hash response
-func (w *etagWriter) etag() string {
+func (w *etagWriter) etag(strong bool) string {
 	sumHash := w.sumHash()
 	base64Hash := base64.StdEncoding.EncodeToString(sumHash)
 	len := strconv.FormatInt(int64(w.buf.Len()), 16) // hexidecimal
+	if strong {
+		return fmt.Sprintf("\"%v-%v\"", len, base64Hash)
+	}
 	return fmt.Sprintf("W/\"%v-%v\"", len, base64Hash)
 }
+
+// matchesAny checks if any of the comma separated ETags in the If-Match or If-None-Match header value match the ETag,
+// using the header's comparison function. * matches any ETag
+func matchesAny(header string, etag string, match func(a string, b string) bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || (candidate != "" && match(candidate, etag)) {
+			return true
+		}
+	}
+	return false
+}
+
+// varyKey joins the request header values listed in the response's Vary header.
+// Headers the request doesn't send are skipped, so it's "" for the default representation
+func varyKey(header http.Header, r *http.Request) string {
+	var key strings.Builder
+	for _, vary := range header.Values("Vary") {
+		for _, name := range strings.Split(vary, ",") {
+			values := r.Header.Values(strings.TrimSpace(name))
+			if len(values) == 0 {
+				continue
+			}
+			key.WriteString(http.CanonicalHeaderKey(strings.TrimSpace(name)) + ":" + strings.Join(values, ",") + "\n")
+		}
+	}
+	return key.String()
+}
+
+// strongMatch compares the ETags using RFC 7232's strong comparison, used for If-Match:
+// both must be strong & identical, so weak ETags never match
+func strongMatch(a string, b string) bool {
+	return !isWeakEtag(a) && !isWeakEtag(b) && a == b
+}
+
+// weakMatch compares the ETags using RFC 7232's weak comparison, used for If-None-Match:
+// their opaque tags must be identical, whether or not either is weak
+func weakMatch(a string, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// isWeakEtag checks if the ETag is a weak validator, i.e. has the W/ prefix
+func isWeakEtag(etag string) bool {
+	return strings.HasPrefix(etag, "W/")
+}
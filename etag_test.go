@@ -4,10 +4,12 @@ import (
 	"crypto/md5"
 	"crypto/sha1"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"hash"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -143,3 +145,477 @@ func calculateHash(hash hash.Hash, text string) string {
 	len := len(text)
 	return fmt.Sprintf("W/\"%v-%v\"", len, base64Hash)
 }
+
+// TestEtagWithOptionsMethods tests that only requests using the allowed methods are given ETags
+func TestEtagWithOptionsMethods(t *testing.T) {
+
+	tests := []struct {
+		method string
+		etag   bool
+	}{
+		{"GET", true},
+		{"PUT", true},
+		{"POST", false},
+	}
+
+	for _, test := range tests {
+
+		// Arrange
+		r, _ := http.NewRequest(test.method, "/test", nil)
+		w := httptest.NewRecorder()
+		etag := EtagWithOptions(EtagOptions{Hash: sha1.New, Methods: []string{"GET", "PUT"}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("Test"))
+		}))
+
+		// Act
+		etag.ServeHTTP(w, r)
+
+		// Assert
+		if w.Code != http.StatusOK || w.Body.String() != "Test" {
+			t.Fatalf("Expected the %s response to be written but was %v %s", test.method, w.Code, w.Body.String())
+		}
+		if hasEtag := w.Header().Get("ETag") != ""; hasEtag != test.etag {
+			t.Fatalf("Expected the %s response to have an ETag %v but was %v", test.method, test.etag, hasEtag)
+		}
+	}
+}
+
+// TestEtagWithOptionsMaxSize tests that responses larger than MaxSize are streamed in full without an ETag
+func TestEtagWithOptionsMaxSize(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	w := httptest.NewRecorder()
+	etag := EtagWithOptions(EtagOptions{MaxSize: 6})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("Test"))
+		w.Write([]byte("Test"))
+		w.Write([]byte("Test"))
+	}))
+
+	// Act
+	etag.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusCreated || w.Body.String() != "TestTestTest" {
+		t.Fatalf("Expected the full response to be written but was %v %s", w.Code, w.Body.String())
+	}
+	if h := w.Header().Get("ETag"); h != "" {
+		t.Fatalf("Expected no ETag but was %s", h)
+	}
+}
+
+// TestEtagPostPassThrough tests that a POST request never gets an ETag or a StatusNotModified (304), even with a matching If-None-Match
+func TestEtagPostPassThrough(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/test", nil)
+	r.Header.Add("If-None-Match", "W/\"4-DLxmEfVUC9CAmjiNyVphWw==\"")
+	w := httptest.NewRecorder()
+	etag := DefaultEtag(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Test"))
+	}))
+
+	// Act
+	etag.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK || w.Body.String() != "Test" {
+		t.Fatalf("Expected the POST response to be written but was %v %s", w.Code, w.Body.String())
+	}
+	if h := w.Header().Get("ETag"); h != "" {
+		t.Fatalf("Expected no ETag for a POST but was %s", h)
+	}
+}
+
+// TestEtagIfMatch tests that a matching If-Match header is served, & a non matching one gets a StatusPreconditionFailed (412) without the body
+func TestEtagIfMatch(t *testing.T) {
+
+	tests := []struct {
+		ifMatch string
+		status  int
+		body    string
+	}{
+		{"\"4-DLxmEfVUC9CAmjiNyVphWw==\"", http.StatusOK, "Test"},
+		{"*", http.StatusOK, "Test"},
+		{"\"4-stale\"", http.StatusPreconditionFailed, ""},
+	}
+
+	for _, test := range tests {
+
+		// Arrange
+		r, _ := http.NewRequest("GET", "/test", nil)
+		r.Header.Add("If-Match", test.ifMatch)
+		w := httptest.NewRecorder()
+		etag := EtagWithOptions(EtagOptions{Strong: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("Test"))
+		}))
+
+		// Act
+		etag.ServeHTTP(w, r)
+
+		// Assert
+		if w.Code != test.status {
+			t.Fatalf("Status %v expected for If-Match %s but was %v", test.status, test.ifMatch, w.Code)
+		}
+		if w.Body.String() != test.body {
+			t.Fatalf("Body %s expected for If-Match %s but was %s", test.body, test.ifMatch, w.Body.String())
+		}
+	}
+}
+
+// TestEtagCurrentETag tests that If-Match is evaluated against the CurrentETag before the handler is called,
+// so a PUT of a stale version gets a StatusPreconditionFailed (412) without the handler being invoked
+func TestEtagCurrentETag(t *testing.T) {
+
+	tests := []struct {
+		ifMatch string
+		current string
+		status  int
+		invoked bool
+	}{
+		{"\"v2\"", "\"v2\"", http.StatusNoContent, true},
+		{"\"v1\"", "\"v2\"", http.StatusPreconditionFailed, false},
+		{"W/\"v2\"", "\"v2\"", http.StatusPreconditionFailed, false},
+		{"*", "\"v2\"", http.StatusNoContent, true},
+		{"*", "", http.StatusPreconditionFailed, false},
+	}
+
+	for _, test := range tests {
+
+		// Arrange
+		r, _ := http.NewRequest("PUT", "/test", strings.NewReader("Test"))
+		r.Header.Add("If-Match", test.ifMatch)
+		w := httptest.NewRecorder()
+		invoked := false
+		etag := EtagWithOptions(EtagOptions{CurrentETag: func(r *http.Request) (string, error) {
+			return test.current, nil
+		}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			invoked = true
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		// Act
+		etag.ServeHTTP(w, r)
+
+		// Assert
+		if w.Code != test.status {
+			t.Fatalf("Status %v expected for If-Match %s but was %v", test.status, test.ifMatch, w.Code)
+		}
+		if invoked != test.invoked {
+			t.Fatalf("Expected the handler invoked to be %v for If-Match %s but was %v", test.invoked, test.ifMatch, invoked)
+		}
+	}
+}
+
+// TestEtagCurrentETagError tests that a CurrentETag error returns a StatusInternalServerError (500) without calling the handler
+func TestEtagCurrentETagError(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("DELETE", "/test", nil)
+	r.Header.Add("If-Match", "\"v1\"")
+	w := httptest.NewRecorder()
+	etag := EtagWithOptions(EtagOptions{CurrentETag: func(r *http.Request) (string, error) {
+		return "", errors.New("Lookup failed")
+	}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	etag.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("StatusInternalServerError 500 expected but was %v", w.Code)
+	}
+}
+
+// TestEtagIfNoneMatchWildcard tests that an If-None-Match * matches any ETag
+func TestEtagIfNoneMatchWildcard(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	r.Header.Add("If-None-Match", "*")
+	w := httptest.NewRecorder()
+	etag := DefaultEtag(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Test"))
+	}))
+
+	// Act
+	etag.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("StatusNotModified 304 expected - %d", w.Code)
+	}
+}
+
+// TestEtagStrongComparison tests RFC 7232's comparison rules: weak ETags never match If-Match, but do match If-None-Match
+func TestEtagStrongComparison(t *testing.T) {
+
+	tests := []struct {
+		strong      bool
+		header      string
+		value       string
+		status      int
+		description string
+	}{
+		{true, "If-Match", "\"4-DLxmEfVUC9CAmjiNyVphWw==\"", http.StatusOK, "strong If-Match against a strong ETag"},
+		{true, "If-Match", "W/\"4-DLxmEfVUC9CAmjiNyVphWw==\"", http.StatusPreconditionFailed, "weak If-Match against a strong ETag"},
+		{false, "If-Match", "W/\"4-DLxmEfVUC9CAmjiNyVphWw==\"", http.StatusPreconditionFailed, "weak If-Match against a weak ETag"},
+		{true, "If-None-Match", "W/\"4-DLxmEfVUC9CAmjiNyVphWw==\"", http.StatusNotModified, "weak If-None-Match against a strong ETag"},
+		{false, "If-None-Match", "\"4-DLxmEfVUC9CAmjiNyVphWw==\"", http.StatusNotModified, "strong If-None-Match against a weak ETag"},
+	}
+
+	for _, test := range tests {
+
+		// Arrange
+		r, _ := http.NewRequest("GET", "/test", nil)
+		r.Header.Add(test.header, test.value)
+		w := httptest.NewRecorder()
+		etag := EtagWithOptions(EtagOptions{Strong: test.strong})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("Test"))
+		}))
+
+		// Act
+		etag.ServeHTTP(w, r)
+
+		// Assert
+		if w.Code != test.status {
+			t.Fatalf("Status %v expected for %s but was %v", test.status, test.description, w.Code)
+		}
+		if weak := isWeakEtag(w.Header().Get("ETag")); weak == test.strong {
+			t.Fatalf("Expected a strong ETag %v for %s but was %s", test.strong, test.description, w.Header().Get("ETag"))
+		}
+	}
+}
+
+// TestEtagIfNoneMatchList tests that a StatusNotModified (304) is returned when any of the If-None-Match ETags match
+func TestEtagIfNoneMatchList(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	r.Header.Add("If-None-Match", "W/\"4-stale\",  W/\"4-DLxmEfVUC9CAmjiNyVphWw==\" ,\"5-other\"")
+	w := httptest.NewRecorder()
+	etag := DefaultEtag(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Test"))
+	}))
+
+	// Act
+	etag.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("StatusNotModified 304 expected - %d", w.Code)
+	}
+}
+
+// unusedHash is a hash.Hash which fails the test if the body is hashed
+type unusedHash struct {
+	hash.Hash
+	t *testing.T
+}
+
+func (h unusedHash) Write(b []byte) (int, error) {
+	h.t.Fatal("Expected the body not to be hashed")
+	return 0, nil
+}
+
+// TestEtagHandlerSet tests that an ETag set by the handler is used for the comparison without hashing the body
+func TestEtagHandlerSet(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	r.Header.Add("If-None-Match", "\"v3\"")
+	w := httptest.NewRecorder()
+	options := EtagOptions{Hash: func() hash.Hash { return unusedHash{md5.New(), t} }}
+	etag := EtagWithOptions(options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", "\"v3\"")
+		w.Write([]byte("Test"))
+	}))
+
+	// Act
+	etag.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("StatusNotModified 304 expected - %d", w.Code)
+	}
+	if h := w.Header().Get("ETag"); h != "\"v3\"" {
+		t.Fatalf("Expected the handler's ETag \"v3\" but was %s", h)
+	}
+}
+
+// TestEtagNotModifiedHeaders tests that the handler's caching headers are kept on a StatusNotModified (304), while the body's are dropped
+func TestEtagNotModifiedHeaders(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	r.Header.Add("If-None-Match", "W/\"4-DLxmEfVUC9CAmjiNyVphWw==\"")
+	w := httptest.NewRecorder()
+	etag := DefaultEtag(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", "4")
+		w.Write([]byte("Test"))
+	}))
+
+	// Act
+	etag.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("StatusNotModified 304 expected - %d", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Fatalf("Expected no body but was %s", w.Body.String())
+	}
+	if h := w.Header().Get("Cache-Control"); h != "max-age=60" {
+		t.Fatalf("Expected the handler's Cache-Control header max-age=60 but was %s", h)
+	}
+	if h := w.Header().Get("Vary"); h != "Accept-Language" {
+		t.Fatalf("Expected the handler's Vary header Accept-Language but was %s", h)
+	}
+	if h := w.Header().Get("Content-Length"); h != "" {
+		t.Fatalf("Expected no Content-Length header but was %s", h)
+	}
+}
+
+// TestGetETag tests that an outer middleware can read the computed ETag
+func TestGetETag(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	w := httptest.NewRecorder()
+	var computed string
+	outer := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := WithETag(r.Context())
+			next.ServeHTTP(w, r.WithContext(ctx))
+			computed = GetETag(ctx)
+		})
+	}
+	handler := Chain(outer, DefaultEtag).Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Test"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if computed != "W/\"4-DLxmEfVUC9CAmjiNyVphWw==\"" {
+		t.Fatalf("Expected the computed ETag to be readable but was %s", computed)
+	}
+	if computed != w.Header().Get("ETag") {
+		t.Fatalf("Expected the computed ETag to match the ETag header %s but was %s", w.Header().Get("ETag"), computed)
+	}
+}
+
+// TestEtagErrorStatusPreserved tests that 4xx & 5xx responses are written as the handler wrote them, without an ETag,
+// even when the conditional headers would otherwise match
+func TestEtagErrorStatusPreserved(t *testing.T) {
+
+	tests := []int{http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError, http.StatusBadGateway}
+
+	for _, status := range tests {
+
+		// Arrange
+		r, _ := http.NewRequest("GET", "/test", nil)
+		r.Header.Add("If-None-Match", "*")
+		w := httptest.NewRecorder()
+		etag := DefaultEtag(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("Error"))
+		}))
+
+		// Act
+		etag.ServeHTTP(w, r)
+
+		// Assert
+		if w.Code != status {
+			t.Fatalf("Status %v expected - %d", status, w.Code)
+		}
+		if w.Body.String() != "Error" {
+			t.Fatalf("Expected the error body for status %v but was %s", status, w.Body.String())
+		}
+		if h := w.Header().Get("ETag"); h != "" {
+			t.Fatalf("Expected no ETag for status %v but was %s", status, h)
+		}
+	}
+}
+
+// TestEtagNoResponse tests that a handler which writes nothing gets the default StatusOK (200) without an ETag
+func TestEtagNoResponse(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	w := httptest.NewRecorder()
+	etag := DefaultEtag(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// Act
+	etag.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected - %d", w.Code)
+	}
+	if h := w.Header().Get("ETag"); h != "" {
+		t.Fatalf("Expected no ETag but was %s", h)
+	}
+}
+
+// TestEtagVary tests that requests differing only in a header the response varies by get different ETags
+func TestEtagVary(t *testing.T) {
+
+	// Arrange
+	etag := DefaultEtag(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Vary", "Accept-Encoding, Accept-Language")
+		w.Write([]byte("Test"))
+	}))
+	etags := make([]string, 0, 2)
+
+	// Act
+	for _, language := range []string{"en", "fr"} {
+		r, _ := http.NewRequest("GET", "/test", nil)
+		r.Header.Set("Accept-Language", language)
+		w := httptest.NewRecorder()
+		etag.ServeHTTP(w, r)
+		etags = append(etags, w.Header().Get("ETag"))
+	}
+
+	// Assert
+	if etags[0] == "" || etags[0] == etags[1] {
+		t.Fatalf("Expected different ETags for each Accept-Language but were %v", etags)
+	}
+}
+
+// TestEtagInformationalStatus tests that a 1xx status is written straight through rather than taken as the final status
+func TestEtagInformationalStatus(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	events := []string{}
+	w := &timedWriter{header: http.Header{}, events: &events}
+	etag := DefaultEtag(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusEarlyHints)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("Test"))
+	}))
+
+	// Act
+	etag.ServeHTTP(w, r)
+
+	// Assert
+	expected := []string{"status 103", "status 201", "write Test"}
+	if strings.Join(events, ", ") != strings.Join(expected, ", ") {
+		t.Fatalf("Expected the writes %v but were %v", expected, events)
+	}
+	if w.header.Get("ETag") == "" {
+		t.Fatal("Expected the final response to have an ETag")
+	}
+}
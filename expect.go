@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ExpectOptions defines the user supplied ExpectContinue configuration options.
+type ExpectOptions struct {
+	// MaxBytes rejects requests whose Content-Length is larger with a StatusRequestEntityTooLarge (413)
+	// Default: 0, no limit
+	MaxBytes int64
+	// RequireAuthorization rejects requests without an Authorization header with a StatusUnauthorized (401),
+	// as the Auth middleware would once the body had been sent. Default: false
+	RequireAuthorization bool
+	// Check decides, from the request's headers, whether the body should be sent.
+	// It returns 0 to let the request proceed, or the final status to reject it with
+	Check func(r *http.Request) int
+}
+
+// ExpectContinue middleware rejects requests with an Expect: 100-continue header before the client sends the body, saving bandwidth.
+// net/http only sends the 100 Continue interim response once the handler reads the body, so rejected requests
+// are given their final status without the body ever being sent. Requests which pass the checks proceed as usual.
+// Requests without an Expect: 100-continue header are passed on unchecked, leaving them to the handler
+func ExpectContinue(opts ExpectOptions) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.EqualFold(r.Header.Get("Expect"), "100-continue") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			status := 0
+			switch {
+			case opts.MaxBytes > 0 && r.ContentLength > opts.MaxBytes:
+				status = http.StatusRequestEntityTooLarge
+			case opts.RequireAuthorization && r.Header.Get("Authorization") == "":
+				status = http.StatusUnauthorized
+			case opts.Check != nil:
+				status = opts.Check(r)
+			}
+
+			if status != 0 {
+				// the unsent body can't be drained, so the connection can't be reused
+				w.Header().Set("Connection", "close")
+				w.WriteHeader(status)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// unsentBody is a request body which fails the test if it's read, as the client hasn't sent it
+type unsentBody struct {
+	t *testing.T
+}
+
+func (b unsentBody) Read(p []byte) (int, error) {
+	b.t.Fatal("Expected the body not to be read before the request was accepted")
+	return 0, errors.New("Body not sent")
+}
+
+func (b unsentBody) Close() error {
+	return nil
+}
+
+// TestExpectContinueRejectedPreBody tests that oversized & unauthorized requests are rejected without reading the body
+func TestExpectContinueRejectedPreBody(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		contentLength int64
+		authorization string
+		status        int
+	}{
+		{"oversized", 2048, "JWT token", http.StatusRequestEntityTooLarge},
+		{"unauthorized", 512, "", http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+
+		// Arrange
+		r, _ := http.NewRequest("PUT", "/upload", nil)
+		r.Body = unsentBody{t}
+		r.ContentLength = test.contentLength
+		r.Header.Set("Expect", "100-continue")
+		if test.authorization != "" {
+			r.Header.Set("Authorization", test.authorization)
+		}
+		w := httptest.NewRecorder()
+		handler := ExpectContinue(ExpectOptions{MaxBytes: 1024, RequireAuthorization: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Fatal("Next handler should not have been called")
+		}))
+
+		// Act
+		handler.ServeHTTP(w, r)
+
+		// Assert
+		if w.Code != test.status {
+			t.Fatalf("Status %v expected for the %s request but was %v", test.status, test.name, w.Code)
+		}
+		if c := w.Header().Get("Connection"); c != "close" {
+			t.Fatalf("Expected the connection to be closed for the %s request but was %s", test.name, c)
+		}
+	}
+}
+
+// TestExpectContinueAllowed tests that a request which passes the checks proceeds & its body can be read
+func TestExpectContinueAllowed(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("PUT", "/upload", strings.NewReader("file contents"))
+	r.Header.Set("Expect", "100-continue")
+	r.Header.Set("Authorization", "JWT token")
+	w := httptest.NewRecorder()
+	options := ExpectOptions{
+		MaxBytes:             1024,
+		RequireAuthorization: true,
+		Check: func(r *http.Request) int {
+			if r.Header.Get("Content-Type") == "application/x-msdownload" {
+				return http.StatusUnsupportedMediaType
+			}
+			return 0
+		},
+	}
+	handler := ExpectContinue(options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != "file contents" {
+			t.Fatalf("Expected the body to be readable but was %s", body)
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusCreated {
+		t.Fatalf("StatusCreated 201 expected but was %v", w.Code)
+	}
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+)
+
+// ExplicitStatusOptions defines the user supplied RequireExplicitStatus configuration options.
+type ExplicitStatusOptions struct {
+	// Strict replaces the response with a StatusInternalServerError (500) when
+	// the handler didn't set an explicit status. Default: false, only log
+	Strict bool
+	// Logf is used to report handlers which didn't set an explicit status
+	// Default: log.Printf
+	Logf func(format string, v ...interface{})
+}
+
+// RequireExplicitStatus middleware is a development aid which reports handlers that write a body
+// without ever calling WriteHeader, relying on net/http's implicit StatusOK (200).
+// Offending requests are logged using log.Printf
+func RequireExplicitStatus() Middleware {
+	return RequireExplicitStatusWithOptions(ExplicitStatusOptions{})
+}
+
+// RequireExplicitStatusWithOptions is RequireExplicitStatus with the ability to log elsewhere
+// or to fail offending requests with a StatusInternalServerError (500)
+func RequireExplicitStatusWithOptions(options ExplicitStatusOptions) Middleware {
+
+	if options.Logf == nil {
+		options.Logf = log.Printf
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			sw := &statusWriter{rw: w, buf: bytes.NewBuffer(nil)}
+			next.ServeHTTP(sw, r)
+
+			if sw.implicit {
+				options.Logf("middleware: %s %s wrote a response body without an explicit status", r.Method, r.URL.Path)
+				if options.Strict {
+					sw.status = http.StatusInternalServerError
+					sw.buf.Reset()
+				}
+			}
+
+			sw.Finish()
+		})
+	}
+}
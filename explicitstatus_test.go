@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRequireExplicitStatusImplicitWrite tests that a warning is logged when the handler only calls Write
+func TestRequireExplicitStatusImplicitWrite(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	warnings := 0
+	options := ExplicitStatusOptions{Logf: func(format string, v ...interface{}) {
+		warnings++
+	}}
+	handler := RequireExplicitStatusWithOptions(options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Test"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if warnings != 1 {
+		t.Fatalf("Expected 1 warning but got %v", warnings)
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	if s := w.Body.String(); s != "Test" {
+		t.Fatalf("\"Test\" response body expected but was %v", s)
+	}
+}
+
+// TestRequireExplicitStatusExplicitWrite tests that no warning is logged when the handler calls WriteHeader
+func TestRequireExplicitStatusExplicitWrite(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	options := ExplicitStatusOptions{Logf: func(format string, v ...interface{}) {
+		t.Fatal("No warning expected when the status is set explicitly")
+	}}
+	handler := RequireExplicitStatusWithOptions(options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("Test"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusCreated {
+		t.Fatalf("StatusCreated 201 expected but was %v", w.Code)
+	}
+}
+
+// TestRequireExplicitStatusStrict tests that StatusInternalServerError is returned in strict mode when the handler only calls Write
+func TestRequireExplicitStatusStrict(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	options := ExplicitStatusOptions{Strict: true, Logf: func(format string, v ...interface{}) {}}
+	handler := RequireExplicitStatusWithOptions(options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Test"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("StatusInternalServerError 500 expected but was %v", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Fatalf("Expected an empty body but was %v", w.Body.String())
+	}
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// FieldSelect middleware prunes JSON responses down to the fields requested in the named query parameter,
+// reducing the payload size for bandwidth constrained clients. e.g. ?fields=id,author.name
+// Fields are comma separated, and nested fields are selected using dot separated paths.
+// Selections apply to each element of an array. Fields which don't exist in the response are ignored.
+// Only successful (2xx) JSON responses are pruned, and requests without the query parameter are unchanged.
+func FieldSelect(param string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			fields := r.URL.Query().Get(param)
+			if fields == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			sw := &statusWriter{rw: w, buf: bytes.NewBuffer(nil)}
+			next.ServeHTTP(sw, r)
+
+			if isHTTPStatusOk(sw.status) && isJSON(w.Header()) {
+				if body, err := selectFields(sw.buf.Bytes(), parseFieldSelection(fields)); err == nil {
+					sw.buf = bytes.NewBuffer(body)
+					w.Header().Del("Content-Length")
+				}
+			}
+			sw.Finish()
+		})
+	}
+}
+
+// fieldSelection is a tree of selected fields. A nil selection selects the whole field
+type fieldSelection map[string]fieldSelection
+
+// parseFieldSelection parses the comma separated list of dot separated field paths
+func parseFieldSelection(fields string) fieldSelection {
+	selection := fieldSelection{}
+	for _, path := range strings.Split(fields, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		node := selection
+		names := strings.Split(path, ".")
+		for i, name := range names {
+			child, exists := node[name]
+			if i == len(names)-1 {
+				node[name] = nil
+				break
+			}
+			if exists && child == nil {
+				// the whole field is already selected
+				break
+			}
+			if !exists {
+				child = fieldSelection{}
+				node[name] = child
+			}
+			node = child
+		}
+	}
+	return selection
+}
+
+// selectFields prunes the JSON body down to the selected fields
+func selectFields(body []byte, selection fieldSelection) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(prune(value, selection))
+}
+
+// prune removes the fields which aren't selected from the value
+func prune(value interface{}, selection fieldSelection) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		pruned := map[string]interface{}{}
+		for name, child := range selection {
+			field, ok := value[name]
+			if !ok {
+				continue
+			}
+			if child == nil {
+				pruned[name] = field
+			} else if isJSONContainer(field) {
+				pruned[name] = prune(field, child)
+			}
+		}
+		return pruned
+	case []interface{}:
+		pruned := make([]interface{}, len(value))
+		for i, element := range value {
+			pruned[i] = prune(element, selection)
+		}
+		return pruned
+	}
+	return value
+}
+
+// isJSONContainer checks if the decoded JSON value is an object or array
+func isJSONContainer(value interface{}) bool {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return true
+	}
+	return false
+}
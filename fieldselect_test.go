@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fieldSelectTestHandler writes a JSON object with nested fields
+var fieldSelectTestHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"a":1,"b":{"c":2,"d":3},"e":[{"f":4,"g":5}]}`))
+})
+
+// TestFieldSelectTopLevel tests that a top level selection removes every other field
+func TestFieldSelectTopLevel(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/?fields=a,missing", nil)
+	w := httptest.NewRecorder()
+	handler := FieldSelect("fields")(fieldSelectTestHandler)
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	if s := w.Body.String(); s != `{"a":1}` {
+		t.Fatalf(`Expected {"a":1} but was %v`, s)
+	}
+}
+
+// TestFieldSelectNested tests that a nested dot path selection only keeps the nested field
+func TestFieldSelectNested(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/?fields=b.c,e.g,a.invalid", nil)
+	w := httptest.NewRecorder()
+	handler := FieldSelect("fields")(fieldSelectTestHandler)
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if s := w.Body.String(); s != `{"b":{"c":2},"e":[{"g":5}]}` {
+		t.Fatalf(`Expected {"b":{"c":2},"e":[{"g":5}]} but was %v`, s)
+	}
+}
+
+// TestFieldSelectNoParam tests that the response is unchanged when no fields are requested
+func TestFieldSelectNoParam(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler := FieldSelect("fields")(fieldSelectTestHandler)
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if s := w.Body.String(); s != `{"a":1,"b":{"c":2,"d":3},"e":[{"f":4,"g":5}]}` {
+		t.Fatalf("Expected an unchanged body but was %v", s)
+	}
+}
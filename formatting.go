@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// FormatOptions are the locale specific options handlers use to format numbers & dates in responses
+type FormatOptions struct {
+	// Locale is the BCP 47 language tag the options were derived for, e.g. de-DE
+	Locale string
+	// DecimalSeparator separates the integer & fractional parts of a number, e.g. "." or ","
+	DecimalSeparator string
+	// GroupSeparator separates groups of thousands, e.g. "," or "."
+	GroupSeparator string
+	// DateFormat is the time.Format layout used for dates, e.g. 01/02/2006 or 02.01.2006
+	DateFormat string
+	// Location is the client's timezone
+	Location *time.Location
+}
+
+// FormattingContext middleware derives the locale specific formatting options for the request, using the supplied fn,
+// and adds them to the request context. Handlers read them using GetFormatOptions, so that responses are rendered
+// consistently for the client's locale. fn typically derives the options from the Accept-Language header
+func FormattingContext(fn func(*http.Request) FormatOptions) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), formatOptionsKey, fn(r))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// format options context key
+var formatOptionsKey = &contextKey{"FormatOptions"}
+
+// GetFormatOptions gets the formatting options stored in the context, or the zero FormatOptions if FormattingContext isn't in use
+func GetFormatOptions(ctx context.Context) FormatOptions {
+	options, _ := ctx.Value(formatOptionsKey).(FormatOptions)
+	return options
+}
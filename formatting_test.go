@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// formatOptionsForLanguage derives the formatting options from the Accept-Language header
+func formatOptionsForLanguage(r *http.Request) FormatOptions {
+	if strings.HasPrefix(r.Header.Get("Accept-Language"), "de") {
+		berlin := time.FixedZone("CET", 60*60)
+		return FormatOptions{Locale: "de-DE", DecimalSeparator: ",", GroupSeparator: ".", DateFormat: "02.01.2006", Location: berlin}
+	}
+	return FormatOptions{Locale: "en-US", DecimalSeparator: ".", GroupSeparator: ",", DateFormat: "01/02/2006", Location: time.UTC}
+}
+
+// TestFormattingContextLocales tests that the formatting options derived for each locale are readable downstream
+func TestFormattingContextLocales(t *testing.T) {
+
+	tests := []struct {
+		language         string
+		decimalSeparator string
+		date             string
+	}{
+		{"de-DE,de;q=0.9", ",", "31.12.2018"},
+		{"en-US", ".", "12/31/2018"},
+	}
+
+	for _, test := range tests {
+
+		// Arrange
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Language", test.language)
+		w := httptest.NewRecorder()
+		var options FormatOptions
+		handler := FormattingContext(formatOptionsForLanguage)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			options = GetFormatOptions(r.Context())
+		}))
+
+		// Act
+		handler.ServeHTTP(w, r)
+
+		// Assert
+		if options.DecimalSeparator != test.decimalSeparator {
+			t.Fatalf("Expected decimal separator %s for %s but was %s", test.decimalSeparator, test.language, options.DecimalSeparator)
+		}
+		date := time.Date(2018, 12, 31, 12, 0, 0, 0, time.UTC).In(options.Location).Format(options.DateFormat)
+		if date != test.date {
+			t.Fatalf("Expected date %s for %s but was %s", test.date, test.language, date)
+		}
+	}
+}
+
+// TestGetFormatOptionsNotSet tests that the zero FormatOptions is returned when FormattingContext isn't in use
+func TestGetFormatOptionsNotSet(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+
+	// Act
+	options := GetFormatOptions(r.Context())
+
+	// Assert
+	if options != (FormatOptions{}) {
+		t.Fatalf("Expected the zero FormatOptions but was %+v", options)
+	}
+}
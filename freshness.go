@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// freshnessSkew is the tolerance allowed for clock skew between the client & this server
+const freshnessSkew = 30 * time.Second
+
+// FreshnessCheck middleware bounds the window in which a signed API request can be replayed.
+// Requests must have an X-Timestamp header, in unix seconds, within maxAge of now.
+// Stale, future dated, missing or malformed timestamps are rejected with a StatusUnauthorized (401).
+// A tolerance of 30 seconds is allowed either side for clock skew.
+// The timestamp must be covered by the request's signature, verified by a preceding middleware, so that it can't be altered
+func FreshnessCheck(maxAge time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seconds, err := strconv.ParseInt(r.Header.Get("X-Timestamp"), 10, 64)
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			age := time.Since(time.Unix(seconds, 0))
+			if age > maxAge+freshnessSkew || age < -freshnessSkew {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestFreshnessCheckTimestamps tests that fresh timestamps are passed on while stale, future dated & missing ones are unauthorized
+func TestFreshnessCheckTimestamps(t *testing.T) {
+
+	now := time.Now()
+	tests := []struct {
+		name      string
+		timestamp string
+		status    int
+	}{
+		{"fresh", strconv.FormatInt(now.Add(-time.Minute).Unix(), 10), http.StatusOK},
+		{"skewed", strconv.FormatInt(now.Add(10*time.Second).Unix(), 10), http.StatusOK},
+		{"stale", strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10), http.StatusUnauthorized},
+		{"future", strconv.FormatInt(now.Add(time.Hour).Unix(), 10), http.StatusUnauthorized},
+		{"missing", "", http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+
+		// Arrange
+		r, _ := http.NewRequest("POST", "/", nil)
+		if test.timestamp != "" {
+			r.Header.Set("X-Timestamp", test.timestamp)
+		}
+		w := httptest.NewRecorder()
+		handler := FreshnessCheck(5 * time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		// Act
+		handler.ServeHTTP(w, r)
+
+		// Assert
+		if w.Code != test.status {
+			t.Fatalf("Status %v expected for a %s timestamp but was %v", test.status, test.name, w.Code)
+		}
+	}
+}
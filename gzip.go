@@ -0,0 +1,259 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gzipMinSize is the response size below which compression isn't worth the overhead
+const gzipMinSize = 1024
+
+// GzipOptions defines the user supplied Gzip configuration options.
+type GzipOptions struct {
+	// Level chooses the compression level for each request, e.g. gzip.BestCompression for clients sending Save-Data: on,
+	// which are short of bandwidth, or gzip.BestSpeed for mobile clients, which are short of CPU.
+	// gzip.NoCompression disables compression for the request & an invalid level falls back to gzip.DefaultCompression.
+	// Default: gzip.DefaultCompression for every request
+	Level func(r *http.Request) int
+}
+
+// Gzip middleware compresses responses for clients which accept gzip, using the given compression level, e.g. gzip.DefaultCompression.
+// Responses smaller than 1KB, already encoded, partial (206) or of an already compressed content type, e.g. images,
+// are written uncompressed. A strong ETag set by the handler is weakened on compressed responses, as the bytes sent differ.
+// It panics if the level is invalid
+func Gzip(level int) Middleware {
+	if _, err := gzip.NewWriterLevel(ioutil.Discard, level); err != nil {
+		panic(err)
+	}
+	return GzipWithOptions(GzipOptions{Level: func(r *http.Request) int {
+		return level
+	}})
+}
+
+// GzipWithOptions middleware is Gzip configured with the supplied GzipOptions, e.g. to choose the compression level per request
+func GzipWithOptions(opts GzipOptions) Middleware {
+	if opts.Level == nil {
+		opts.Level = func(r *http.Request) int {
+			return gzip.DefaultCompression
+		}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if !acceptsEncoding(r.Header.Get("Accept-Encoding"), "gzip") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			level := opts.Level(r)
+			if level == gzip.NoCompression {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !isValidGzipLevel(level) {
+				level = gzip.DefaultCompression
+			}
+
+			gw := &gzipWriter{rw: w, level: level}
+			defer gw.Close()
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+// isValidGzipLevel checks if the compression level is one gzip.NewWriterLevel accepts
+func isValidGzipLevel(level int) bool {
+	return level >= gzip.HuffmanOnly && level <= gzip.BestCompression
+}
+
+// acceptsEncoding checks if the Accept-Encoding header accepts the content coding with a non zero q value.
+// The coding's own entry takes precedence over *, e.g. "*;q=0, gzip" accepts gzip while "gzip;q=0, *" doesn't
+func acceptsEncoding(acceptEncoding string, coding string) bool {
+	wildcard := 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.TrimSpace(fields[0])
+		if strings.EqualFold(name, coding) {
+			return qValue(fields[1:]) > 0
+		}
+		if name == "*" {
+			wildcard = qValue(fields[1:])
+		}
+	}
+	return wildcard > 0
+}
+
+// qValue gets the q value from the Accept-Encoding entry's parameters, 1 if it isn't set or 0 if it's invalid
+func qValue(params []string) float64 {
+	for _, param := range params {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) == 2 && strings.EqualFold(strings.TrimSpace(kv[0]), "q") {
+			q, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+			if err != nil {
+				return 0
+			}
+			return q
+		}
+	}
+	return 1
+}
+
+// isCompressedType checks if the content type is already compressed, so gzip won't shrink it further
+func isCompressedType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == "image/svg+xml":
+		return false
+	case strings.HasPrefix(mediaType, "image/"), strings.HasPrefix(mediaType, "video/"), strings.HasPrefix(mediaType, "audio/"):
+		return true
+	}
+	switch mediaType {
+	case "application/zip", "application/gzip", "application/x-gzip", "application/x-bzip2", "application/x-7z-compressed", "application/pdf", "font/woff", "font/woff2":
+		return true
+	}
+	return false
+}
+
+// gzipWriter wraps ResponseWriter to gzip the response body.
+// The status & the start of the body are held back until gzipMinSize bytes have been written, the handler flushes or returns,
+// at which point it's decided whether to compress
+type gzipWriter struct {
+	rw      http.ResponseWriter
+	level   int
+	status  int
+	buf     []byte
+	gz      *gzip.Writer
+	decided bool
+}
+
+// Header wraps ResponseWriter's Header
+func (gw *gzipWriter) Header() http.Header {
+	return gw.rw.Header()
+}
+
+// WriteHeader holds back the status until it's decided whether to compress. Only the first call is honoured.
+// Informational (1xx) statuses, e.g. 103 Early Hints, are written straight through
+func (gw *gzipWriter) WriteHeader(status int) {
+	if isInformationalStatus(status) {
+		gw.rw.WriteHeader(status)
+		return
+	}
+	if gw.status != 0 {
+		return
+	}
+	gw.status = status
+}
+
+// Write buffers the body until it's large enough to decide to compress, then writes it through the gzip.Writer
+func (gw *gzipWriter) Write(b []byte) (int, error) {
+	if gw.status == 0 {
+		gw.WriteHeader(http.StatusOK)
+	}
+	if !gw.decided {
+		gw.buf = append(gw.buf, b...)
+		if len(gw.buf) < gzipMinSize {
+			return len(b), nil
+		}
+		if err := gw.start(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if gw.gz != nil {
+		return gw.gz.Write(b)
+	}
+	return gw.rw.Write(b)
+}
+
+// start decides whether to compress, writing the status & the buffered body
+func (gw *gzipWriter) start(compress bool) error {
+	gw.decided = true
+	header := gw.rw.Header()
+	if header.Get("Content-Type") == "" && len(gw.buf) > 0 {
+		// sniff the type from the uncompressed body, as net/http would otherwise sniff the compressed one
+		header.Set("Content-Type", http.DetectContentType(gw.buf))
+	}
+	// a partial response's Content-Range refers to the uncompressed bytes, so it can't be compressed
+	partial := gw.status == http.StatusPartialContent || header.Get("Content-Range") != ""
+	if compress && !partial && header.Get("Content-Encoding") == "" && !isCompressedType(header.Get("Content-Type")) {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		if etag := header.Get("Etag"); etag != "" && !isWeakEtag(etag) {
+			header.Set("Etag", "W/"+etag)
+		}
+		gw.gz, _ = gzip.NewWriterLevel(gw.rw, gw.level)
+	}
+	if gw.status != 0 {
+		gw.rw.WriteHeader(gw.status)
+	}
+
+	buf := gw.buf
+	gw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if gw.gz != nil {
+		_, err := gw.gz.Write(buf)
+		return err
+	}
+	_, err := gw.rw.Write(buf)
+	return err
+}
+
+// Flush implements http.Flusher, e.g. for SSE, compressing the response regardless of its size
+// & flushing the compressed data written so far
+func (gw *gzipWriter) Flush() {
+	if !gw.decided {
+		if gw.status == 0 {
+			gw.WriteHeader(http.StatusOK)
+		}
+		if err := gw.start(true); err != nil {
+			return
+		}
+	}
+	if gw.gz != nil {
+		gw.gz.Flush()
+	}
+	if flusher, ok := gw.rw.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker, e.g. for WebSocket upgrades, by delegating to the underlying ResponseWriter.
+// The connection belongs to the handler once hijacked, so nothing held back is written
+func (gw *gzipWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := gw.rw.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("The ResponseWriter doesn't support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	gw.decided = true
+	gw.buf = nil
+	return conn, rw, nil
+}
+
+// Close writes anything held back, uncompressed if the body was too small, & completes the gzip stream
+func (gw *gzipWriter) Close() error {
+	if !gw.decided {
+		if err := gw.start(false); err != nil {
+			return err
+		}
+	}
+	if gw.gz != nil {
+		return gw.gz.Close()
+	}
+	return nil
+}
@@ -0,0 +1,355 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// largeBody is a response body large enough to be compressed
+var largeBody = strings.Repeat("The quick brown fox jumps over the lazy dog. ", 100)
+
+// TestGzipRoundTrip tests that a gzipped body decompresses to the body the handler wrote
+func TestGzipRoundTrip(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	r.Header.Set("Accept-Encoding", "deflate, gzip;q=0.8")
+	w := httptest.NewRecorder()
+	handler := Gzip(gzip.BestSpeed)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", "4500")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(largeBody[:1000]))
+		w.Write([]byte(largeBody[1000:]))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusCreated {
+		t.Fatalf("StatusCreated 201 expected but was %v", w.Code)
+	}
+	if h := w.Header().Get("Content-Encoding"); h != "gzip" {
+		t.Fatalf("Expected the Content-Encoding header gzip but was %s", h)
+	}
+	if h := w.Header().Get("Content-Length"); h != "" {
+		t.Fatalf("Expected the Content-Length header to be removed but was %s", h)
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != largeBody {
+		t.Fatalf("Expected the body to round trip but was %s", body)
+	}
+}
+
+// TestGzipNotAccepted tests that a client which doesn't accept gzip gets the plain response
+func TestGzipNotAccepted(t *testing.T) {
+
+	tests := []string{"", "deflate, br", "gzip;q=0", "gzip;q=0, *", "*;q=0"}
+
+	for _, acceptEncoding := range tests {
+
+		// Arrange
+		r, _ := http.NewRequest("GET", "/test", nil)
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		handler := Gzip(gzip.DefaultCompression)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(largeBody))
+		}))
+
+		// Act
+		handler.ServeHTTP(w, r)
+
+		// Assert
+		if h := w.Header().Get("Content-Encoding"); h != "" {
+			t.Fatalf("Expected no Content-Encoding header for Accept-Encoding %s but was %s", acceptEncoding, h)
+		}
+		if w.Body.String() != largeBody {
+			t.Fatalf("Expected the plain body for Accept-Encoding %s", acceptEncoding)
+		}
+	}
+}
+
+// TestGzipSkipped tests that small bodies & already compressed content types aren't compressed
+func TestGzipSkipped(t *testing.T) {
+
+	tests := []struct {
+		contentType string
+		body        string
+	}{
+		{"application/json", `{"id":1}`},
+		{"image/png", largeBody},
+	}
+
+	for _, test := range tests {
+
+		// Arrange
+		r, _ := http.NewRequest("GET", "/test", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		handler := Gzip(gzip.DefaultCompression)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", test.contentType)
+			w.Write([]byte(test.body))
+		}))
+
+		// Act
+		handler.ServeHTTP(w, r)
+
+		// Assert
+		if h := w.Header().Get("Content-Encoding"); h != "" {
+			t.Fatalf("Expected no Content-Encoding header for %s but was %s", test.contentType, h)
+		}
+		if w.Body.String() != test.body {
+			t.Fatalf("Expected the plain body for %s but was %s", test.contentType, w.Body.String())
+		}
+	}
+}
+
+// TestGzipFlush tests that the writer implements http.Flusher, compressing the data written so far
+func TestGzipFlush(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/events", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	var flushed []byte
+	handler := Gzip(gzip.DefaultCompression)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/event-stream")
+		rw.Write([]byte("data: 1\n\n"))
+		flusher, ok := rw.(http.Flusher)
+		if !ok {
+			t.Fatal("Expected the ResponseWriter to implement http.Flusher")
+		}
+		flusher.Flush()
+		flushed = append(flushed, w.Body.Bytes()...)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if !w.Flushed {
+		t.Fatal("Expected the underlying ResponseWriter to be flushed")
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(flushed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 9)
+	if _, err := gz.Read(data); err != nil || string(data) != "data: 1\n\n" {
+		t.Fatalf("Expected the flushed data to decompress to the event but was %q, %v", data, err)
+	}
+}
+
+// TestGzipAcceptsEncoding tests that the coding's own q value takes precedence over *
+func TestGzipAcceptsEncoding(t *testing.T) {
+
+	tests := []struct {
+		acceptEncoding string
+		accepted       bool
+	}{
+		{"gzip", true},
+		{"*", true},
+		{"*;q=0, gzip", true},
+		{"gzip;q=0.5, *;q=0", true},
+		{"GZIP ; q=1.0", true},
+		{"gzip;q=0, *", false},
+		{"*;q=0", false},
+		{"gzip;q=invalid", false},
+		{"br, deflate", false},
+	}
+
+	for _, test := range tests {
+
+		// Act
+		accepted := acceptsEncoding(test.acceptEncoding, "gzip")
+
+		// Assert
+		if accepted != test.accepted {
+			t.Fatalf("Expected Accept-Encoding %s to accept gzip %v but was %v", test.acceptEncoding, test.accepted, accepted)
+		}
+	}
+}
+
+// TestGzipWeakensETag tests that a strong ETag is weakened when the response is compressed
+func TestGzipWeakensETag(t *testing.T) {
+
+	tests := []struct {
+		etag     string
+		expected string
+	}{
+		{`"v1"`, `W/"v1"`},
+		{`W/"v1"`, `W/"v1"`},
+	}
+
+	for _, test := range tests {
+
+		// Arrange
+		r, _ := http.NewRequest("GET", "/test", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		handler := Gzip(gzip.DefaultCompression)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", test.etag)
+			w.Write([]byte(largeBody))
+		}))
+
+		// Act
+		handler.ServeHTTP(w, r)
+
+		// Assert
+		if h := w.Header().Get("ETag"); h != test.expected {
+			t.Fatalf("Expected the ETag %s to be %s but was %s", test.etag, test.expected, h)
+		}
+	}
+}
+
+// TestGzipPartialContent tests that partial responses aren't compressed
+func TestGzipPartialContent(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	r.Header.Set("Range", "bytes=0-2047")
+	w := httptest.NewRecorder()
+	handler := Gzip(gzip.DefaultCompression)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Range", "bytes 0-2047/4500")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte(largeBody[:2048]))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("StatusPartialContent 206 expected but was %v", w.Code)
+	}
+	if h := w.Header().Get("Content-Encoding"); h != "" {
+		t.Fatalf("Expected no Content-Encoding header but was %s", h)
+	}
+	if w.Body.String() != largeBody[:2048] {
+		t.Fatal("Expected the plain partial body")
+	}
+}
+
+// TestGzipHijack tests that the writer implements http.Hijacker, e.g. for WebSocket upgrades
+func TestGzipHijack(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/ws", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := &hijackableWriter{ResponseRecorder: httptest.NewRecorder()}
+	var hijackErr error
+	handler := Gzip(gzip.DefaultCompression)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			t.Fatal("Expected the writer to implement http.Hijacker")
+		}
+		conn, _, err := hijacker.Hijack()
+		hijackErr = err
+		if conn != nil {
+			conn.Close()
+		}
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if hijackErr != nil || !w.hijacked {
+		t.Fatalf("Expected the connection to be hijacked but got %v", hijackErr)
+	}
+	if w.Body.Len() != 0 || w.Header().Get("Content-Encoding") != "" {
+		t.Fatal("Expected nothing to be written once the connection was hijacked")
+	}
+}
+
+// TestGzipWithOptionsLevel tests that the compression level is chosen per request, e.g. from the Save-Data hint
+func TestGzipWithOptionsLevel(t *testing.T) {
+
+	// Arrange
+	options := GzipOptions{Level: func(r *http.Request) int {
+		switch {
+		case r.Header.Get("Save-Data") == "on":
+			return gzip.BestCompression
+		case r.Header.Get("Sec-CH-UA-Mobile") == "?1":
+			return gzip.BestSpeed
+		case r.Header.Get("X-Compression") == "off":
+			return gzip.NoCompression
+		}
+		return gzip.DefaultCompression
+	}}
+	body := strings.Repeat("The quick brown fox jumps over the lazy dog, 0123456789 times. ", 50) + largeBody
+	serve := func(header, value string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", "/test", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		r.Header.Set(header, value)
+		w := httptest.NewRecorder()
+		GzipWithOptions(options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		})).ServeHTTP(w, r)
+		return w
+	}
+	compressedSize := func(level int) int {
+		var buf bytes.Buffer
+		gz, _ := gzip.NewWriterLevel(&buf, level)
+		gz.Write([]byte(body))
+		gz.Close()
+		return buf.Len()
+	}
+
+	// Act
+	saveData := serve("Save-Data", "on")
+	mobile := serve("Sec-CH-UA-Mobile", "?1")
+	off := serve("X-Compression", "off")
+
+	// Assert
+	if size := saveData.Body.Len(); size != compressedSize(gzip.BestCompression) {
+		t.Fatalf("Expected Save-Data to use BestCompression, %v bytes, but was %v bytes", compressedSize(gzip.BestCompression), size)
+	}
+	if size := mobile.Body.Len(); size != compressedSize(gzip.BestSpeed) {
+		t.Fatalf("Expected a mobile client to use BestSpeed, %v bytes, but was %v bytes", compressedSize(gzip.BestSpeed), size)
+	}
+	if compressedSize(gzip.BestCompression) == compressedSize(gzip.BestSpeed) {
+		t.Fatal("Expected the levels to compress the body to different sizes")
+	}
+	if off.Header().Get("Content-Encoding") != "" || off.Body.String() != body {
+		t.Fatal("Expected NoCompression to write the plain body")
+	}
+}
+
+// TestGzipInformationalStatus tests that a 1xx status is written straight through rather than taken as the final status
+func TestGzipInformationalStatus(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	events := []string{}
+	w := &timedWriter{header: http.Header{}, events: &events}
+	handler := Gzip(gzip.DefaultCompression)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusEarlyHints)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("Test"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	expected := []string{"status 103", "status 201", "write Test"}
+	if strings.Join(events, ", ") != strings.Join(expected, ", ") {
+		t.Fatalf("Expected the writes %v but were %v", expected, events)
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// LimitResponseHeaders middleware checks the total size of the response headers before they're flushed.
+// Responses whose headers exceed maxBytes, e.g. because of a huge Set-Cookie, are replaced with an empty
+// StatusInternalServerError (500), as some proxies reject them outright.
+// Headers are measured as they're sent on the wire, "Key: value\r\n" per value
+func LimitResponseHeaders(maxBytes int) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			sw := &statusWriter{rw: w, buf: bytes.NewBuffer(nil)}
+			next.ServeHTTP(sw, r)
+
+			if headerSize(w.Header()) > maxBytes {
+				for k := range w.Header() {
+					delete(w.Header(), k)
+				}
+				sw.status = http.StatusInternalServerError
+				sw.buf.Reset()
+			}
+
+			sw.Finish()
+		})
+	}
+}
+
+// headerSize calculates the number of bytes the header takes up on the wire
+func headerSize(header http.Header) int {
+	size := 0
+	for k, values := range header {
+		for _, v := range values {
+			size += len(k) + len(": ") + len(v) + len("\r\n")
+		}
+	}
+	return size
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestLimitResponseHeadersOverLimit tests that a response with headers over the limit is replaced with a StatusInternalServerError
+func TestLimitResponseHeadersOverLimit(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler := LimitResponseHeaders(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session="+strings.Repeat("a", 2048))
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("body"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("StatusInternalServerError 500 expected but was %v", w.Code)
+	}
+	if c := w.Header().Get("Set-Cookie"); c != "" {
+		t.Fatal("Expected the oversized header to be removed")
+	}
+	if w.Body.Len() != 0 {
+		t.Fatalf("Expected an empty body but was %v", w.Body.String())
+	}
+}
+
+// TestLimitResponseHeadersWithinLimit tests that a response with headers within the limit is passed through
+func TestLimitResponseHeadersWithinLimit(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler := LimitResponseHeaders(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=abc")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("body"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusCreated {
+		t.Fatalf("StatusCreated 201 expected but was %v", w.Code)
+	}
+	if c := w.Header().Get("Set-Cookie"); c != "session=abc" {
+		t.Fatalf("Expected the Set-Cookie header to be kept but was %v", c)
+	}
+	if s := w.Body.String(); s != "body" {
+		t.Fatalf("Expected the body to be kept but was %v", s)
+	}
+}
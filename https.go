@@ -1,20 +1,156 @@
 package middleware
 
 import (
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// HTTPSOptions defines the user supplied HTTPS configuration options.
+type HTTPSOptions struct {
+	// RedirectStatus is the status used to redirect to HTTPS, e.g. a temporary 307 during rollout.
+	// It must be a redirect status. Default: StatusPermanentRedirect (308)
+	RedirectStatus int
+	// ForwardedHeader is the header, set by the proxy terminating TLS, holding the protocol the client used.
+	// The standard Forwarded header's proto parameter is also understood. Default: x-forwarded-proto
+	ForwardedHeader string
+	// TrustedProxies are the CIDRs, e.g. 10.0.0.0/8, of the proxies allowed to set the forwarded header.
+	// Requests from any other address have the header ignored & are treated as HTTP, as a client connecting directly could spoof it.
+	// Default: empty, the header is trusted from any address
+	TrustedProxies []string
+	// HSTSMaxAge is the max-age of the Strict-Transport-Security header set on HTTPS requests
+	// Default: 0, no Strict-Transport-Security header is set
+	HSTSMaxAge time.Duration
+	// HSTSIncludeSubDomains adds the includeSubDomains directive to the Strict-Transport-Security header
+	HSTSIncludeSubDomains bool
+	// HSTSPreload adds the preload directive to the Strict-Transport-Security header
+	HSTSPreload bool
+}
+
 // HTTPS middleware is responsible for redirecting the user to HTTPS
 // It looks at the x-forward-proto header to determine the protocol used
 // x-forward-proto is commonly set when behind load balancer which will terminate the ssl connection. e.g. AWS, Cloud Foundry, etc
+// Requests to a server terminating TLS itself are always treated as HTTPS
 func HTTPS(next http.Handler) http.Handler {
-	fn := func(w http.ResponseWriter, r *http.Request) {
-		proto := r.Header.Get("x-forwarded-proto")
-		if proto == "http" {
-			http.Redirect(w, r, "https://"+r.Host+r.URL.Path, http.StatusPermanentRedirect)
-			return
+	return HTTPSWithOptions(HTTPSOptions{})(next)
+}
+
+// HTTPSWithOptions middleware redirects the user to HTTPS, like HTTPS,
+// and sets a Strict-Transport-Security header on requests which are already HTTPS so browsers pin HTTPS.
+// The header isn't set on the redirect, as browsers ignore it over HTTP
+func HTTPSWithOptions(opts HTTPSOptions) Middleware {
+	if opts.RedirectStatus == 0 {
+		opts.RedirectStatus = http.StatusPermanentRedirect
+	}
+	if opts.ForwardedHeader == "" {
+		opts.ForwardedHeader = "x-forwarded-proto"
+	}
+	if !isRedirectStatus(opts.RedirectStatus) {
+		panic("HTTPS RedirectStatus must be a redirect status, got " + strconv.Itoa(opts.RedirectStatus))
+	}
+	trusted := parseCIDRs(opts.TrustedProxies)
+	hsts := hstsHeader(opts)
+
+	// isHTTP checks whether the client's request was made over plain HTTP
+	isHTTP := func(r *http.Request) bool {
+		if r.TLS != nil {
+			return false
 		}
-		next.ServeHTTP(w, r)
+		if len(trusted) > 0 && !containsIP(trusted, remoteIP(r)) {
+			return true
+		}
+		return strings.EqualFold(forwardedProto(r, opts.ForwardedHeader), "http")
+	}
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if isHTTP(r) {
+				http.Redirect(w, r, "https://"+r.Host+r.URL.RequestURI(), opts.RedirectStatus)
+				return
+			}
+			if hsts != "" {
+				w.Header().Set("Strict-Transport-Security", hsts)
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// forwardedProto gets the protocol the client used from the forwarded header, or "" if it isn't set.
+// For the standard Forwarded header the proto parameter of the first, i.e. client facing, proxy is used
+func forwardedProto(r *http.Request, header string) string {
+	value := r.Header.Get(header)
+	if !strings.EqualFold(header, "Forwarded") {
+		return strings.TrimSpace(value)
+	}
+	first := strings.Split(value, ",")[0]
+	for _, pair := range strings.Split(first, ";") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) == 2 && strings.EqualFold(kv[0], "proto") {
+			return strings.Trim(kv[1], `"`)
+		}
+	}
+	return ""
+}
+
+// parseCIDRs parses the CIDRs, panicking if any are invalid
+func parseCIDRs(cidrs []string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic("Invalid trusted proxy CIDR " + cidr + ": " + err.Error())
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+// containsIP checks if the ip is within any of the networks
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP gets the ip address of the request's immediate peer, or nil if it can't be parsed
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// isRedirectStatus checks if the given http status redirects the user agent to the Location header
+func isRedirectStatus(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// hstsHeader builds the Strict-Transport-Security header value, or "" if HSTS isn't enabled
+func hstsHeader(opts HTTPSOptions) string {
+	if opts.HSTSMaxAge <= 0 {
+		return ""
+	}
+	hsts := "max-age=" + strconv.FormatInt(int64(opts.HSTSMaxAge/time.Second), 10)
+	if opts.HSTSIncludeSubDomains {
+		hsts += "; includeSubDomains"
+	}
+	if opts.HSTSPreload {
+		hsts += "; preload"
 	}
-	return http.HandlerFunc(fn)
+	return hsts
 }
@@ -1,9 +1,11 @@
 package middleware
 
 import (
+	"crypto/tls"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 // TestHTTPSRedirect tests that when the x-forwarded-proto header is set to http
@@ -31,6 +33,30 @@ func TestHTTPSRedirect(t *testing.T) {
 	}
 }
 
+// TestHTTPSRedirectQuery tests that the query string is retained when redirecting to the HTTPS version of the url
+func TestHTTPSRedirectQuery(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test?a=1&b=2", nil)
+	r.Host = "example.com"
+	r.Header.Add("x-forwarded-proto", "http")
+	w := httptest.NewRecorder()
+	https := HTTPS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	https.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusPermanentRedirect {
+		t.Fatalf("StatusPermanentRedirect 308 expected - %d", w.Code)
+	}
+	if w.Header().Get("Location") != "https://example.com/test?a=1&b=2" {
+		t.Fatalf("Expect Location header to retain the query string - %s", w.Header().Get("Location"))
+	}
+}
+
 // TestHTTPSRedirect tests that when the x-forwarded-proto header is set to https
 // the request continues to the next chained http handler
 func TestHTTPSOk(t *testing.T) {
@@ -52,3 +78,185 @@ func TestHTTPSOk(t *testing.T) {
 		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
 	}
 }
+
+// TestHTTPSWithOptionsHSTS tests that the Strict-Transport-Security header is set on HTTPS requests
+func TestHTTPSWithOptionsHSTS(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	r.Host = "example.com"
+	r.Header.Add("x-forwarded-proto", "https")
+	w := httptest.NewRecorder()
+	options := HTTPSOptions{HSTSMaxAge: 365 * 24 * time.Hour, HSTSIncludeSubDomains: true, HSTSPreload: true}
+	https := HTTPSWithOptions(options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	https.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	expected := "max-age=31536000; includeSubDomains; preload"
+	if hsts := w.Header().Get("Strict-Transport-Security"); hsts != expected {
+		t.Fatalf("Strict-Transport-Security header %s expected but was %s", expected, hsts)
+	}
+}
+
+// TestHTTPSWithOptionsRedirectNoHSTS tests that the Strict-Transport-Security header isn't set on the redirect
+func TestHTTPSWithOptionsRedirectNoHSTS(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	r.Host = "example.com"
+	r.Header.Add("x-forwarded-proto", "http")
+	w := httptest.NewRecorder()
+	https := HTTPSWithOptions(HTTPSOptions{HSTSMaxAge: time.Hour})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	https.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusPermanentRedirect {
+		t.Fatalf("StatusPermanentRedirect 308 expected - %d", w.Code)
+	}
+	if hsts := w.Header().Get("Strict-Transport-Security"); hsts != "" {
+		t.Fatalf("Expected no Strict-Transport-Security header on the redirect but was %s", hsts)
+	}
+}
+
+// TestHTTPSWithOptionsRedirectStatus tests that the configured redirect status is used
+func TestHTTPSWithOptionsRedirectStatus(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	r.Host = "example.com"
+	r.Header.Add("x-forwarded-proto", "http")
+	w := httptest.NewRecorder()
+	https := HTTPSWithOptions(HTTPSOptions{RedirectStatus: http.StatusFound})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	https.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusFound {
+		t.Fatalf("StatusFound 302 expected - %d", w.Code)
+	}
+	if w.Header().Get("Location") != "https://example.com/test" {
+		t.Fatalf("Expect Location header to point at https url - %s", w.Header().Get("Location"))
+	}
+}
+
+// TestHTTPSWithOptionsInvalidRedirectStatus tests that a status which isn't a redirect is rejected
+func TestHTTPSWithOptionsInvalidRedirectStatus(t *testing.T) {
+
+	// Arrange
+	defer func() {
+		// Assert
+		if recover() == nil {
+			t.Fatal("Expected a panic for a status which isn't a redirect")
+		}
+	}()
+
+	// Act
+	HTTPSWithOptions(HTTPSOptions{RedirectStatus: http.StatusOK})
+}
+
+// TestHTTPSDirectTLS tests that requests to a server terminating TLS itself aren't redirected
+func TestHTTPSDirectTLS(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	r.Host = "example.com"
+	r.TLS = &tls.ConnectionState{}
+	r.Header.Add("x-forwarded-proto", "http")
+	w := httptest.NewRecorder()
+	https := HTTPS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	https.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
+
+// TestHTTPSWithOptionsForwardedHeader tests that the configured forwarded header is used to determine the protocol,
+// including the proto parameter of the standard Forwarded header
+func TestHTTPSWithOptionsForwardedHeader(t *testing.T) {
+
+	tests := []struct {
+		header string
+		value  string
+		status int
+	}{
+		{"X-Forwarded-Protocol", "http", http.StatusPermanentRedirect},
+		{"X-Forwarded-Protocol", "https", http.StatusOK},
+		{"Forwarded", `for=192.0.2.60;proto=http;by=203.0.113.43`, http.StatusPermanentRedirect},
+		{"Forwarded", `for=192.0.2.60;proto="https", for=198.51.100.17;proto=http`, http.StatusOK},
+	}
+
+	for _, test := range tests {
+
+		// Arrange
+		r, _ := http.NewRequest("GET", "/test", nil)
+		r.Host = "example.com"
+		r.Header.Add(test.header, test.value)
+		r.Header.Add("x-forwarded-proto", "http")
+		w := httptest.NewRecorder()
+		https := HTTPSWithOptions(HTTPSOptions{ForwardedHeader: test.header})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		// Act
+		https.ServeHTTP(w, r)
+
+		// Assert
+		if w.Code != test.status {
+			t.Fatalf("Status %v expected for %s: %s but was %v", test.status, test.header, test.value, w.Code)
+		}
+	}
+}
+
+// TestHTTPSWithOptionsTrustedProxies tests that the forwarded header is only trusted from the trusted proxies,
+// & requests from any other address are redirected
+func TestHTTPSWithOptionsTrustedProxies(t *testing.T) {
+
+	tests := []struct {
+		remoteAddr string
+		status     int
+	}{
+		{"10.1.2.3:41234", http.StatusOK},
+		{"203.0.113.7:41234", http.StatusPermanentRedirect},
+	}
+
+	for _, test := range tests {
+
+		// Arrange
+		r, _ := http.NewRequest("GET", "/test", nil)
+		r.Host = "example.com"
+		r.RemoteAddr = test.remoteAddr
+		r.Header.Add("x-forwarded-proto", "https")
+		w := httptest.NewRecorder()
+		https := HTTPSWithOptions(HTTPSOptions{TrustedProxies: []string{"10.0.0.0/8", "192.168.0.0/16"}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		// Act
+		https.ServeHTTP(w, r)
+
+		// Assert
+		if w.Code != test.status {
+			t.Fatalf("Status %v expected for remote address %s but was %v", test.status, test.remoteAddr, w.Code)
+		}
+	}
+}
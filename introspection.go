@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// introspector validates opaque tokens using an OAuth 2.0 token introspection endpoint (RFC 7662).
+// Introspection results are cached briefly so that every request doesn't call the endpoint
+type introspector struct {
+	url          string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+	cacheTTL     time.Duration
+
+	mu      sync.Mutex
+	cache   map[[sha256.Size]byte]introspection
+	sweptAt time.Time
+}
+
+// introspection is a cached introspection result
+type introspection struct {
+	active  bool
+	claims  jwt.MapClaims
+	expires time.Time
+}
+
+// newIntrospector creates the introspection client for the endpoint
+func newIntrospector(url, clientID, clientSecret string, cacheTTL time.Duration) *introspector {
+	if cacheTTL == 0 {
+		cacheTTL = 30 * time.Second
+	}
+	return &introspector{
+		url:          url,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		cacheTTL:     cacheTTL,
+		cache:        map[[sha256.Size]byte]introspection{},
+	}
+}
+
+// introspect gets the claims of an active token, using the cached result when there is one
+func (i *introspector) introspect(token string) (jwt.MapClaims, error) {
+	// tokens are cached by their hash so that the tokens themselves aren't kept in memory
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+
+	i.mu.Lock()
+	result, ok := i.cache[key]
+	i.mu.Unlock()
+
+	if !ok || now.After(result.expires) {
+		var err error
+		result, err = i.fetch(token, now)
+		if err != nil {
+			return nil, err
+		}
+		i.store(key, result, now)
+	}
+
+	if !result.active {
+		return nil, errors.New("Token is not active")
+	}
+	return result.claims, nil
+}
+
+// fetch posts the token to the introspection endpoint, authenticating with the client credentials
+func (i *introspector) fetch(token string, now time.Time) (introspection, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequest("POST", i.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return introspection{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if i.clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(i.clientID), url.QueryEscape(i.clientSecret))
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return introspection{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return introspection{}, fmt.Errorf("Token introspection failed with status %v", resp.StatusCode)
+	}
+
+	var claims jwt.MapClaims
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return introspection{}, err
+	}
+
+	result := introspection{claims: claims, expires: now.Add(i.cacheTTL)}
+	result.active, _ = claims["active"].(bool)
+	// an active token is never cached beyond its expiry
+	if exp, ok := claims["exp"].(float64); ok && result.active {
+		if expiry := time.Unix(int64(exp), 0); expiry.Before(result.expires) {
+			result.expires = expiry
+		}
+	}
+	return result, nil
+}
+
+// store caches the introspection result, removing expired results at most once per cacheTTL
+func (i *introspector) store(key [sha256.Size]byte, result introspection, now time.Time) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if now.Sub(i.sweptAt) > i.cacheTTL {
+		for k, cached := range i.cache {
+			if now.After(cached.expires) {
+				delete(i.cache, k)
+			}
+		}
+		i.sweptAt = now
+	}
+	i.cache[key] = result
+}
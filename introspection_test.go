@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newIntrospectionServer creates a fake introspection endpoint where only the active token is active. It counts the requests made to it
+func newIntrospectionServer(activeToken string, requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		if id, secret, ok := r.BasicAuth(); !ok || id != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.PostFormValue("token") != activeToken {
+			json.NewEncoder(w).Encode(map[string]interface{}{"active": false})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"active": true, "sub": "user-1"})
+	}))
+}
+
+// TestJWTIntrospectionActiveToken tests that an active opaque token is authorized & its introspection result cached
+func TestJWTIntrospectionActiveToken(t *testing.T) {
+
+	// Arrange
+	requests := 0
+	server := newIntrospectionServer("opaque-token", &requests)
+	defer server.Close()
+	jwtOptions := JWTOptions{
+		IntrospectionURL:          server.URL,
+		IntrospectionClientID:     "client",
+		IntrospectionClientSecret: "secret",
+	}
+	var subject interface{}
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject = GetClaims(r.Context())["sub"]
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	for i := 0; i < 2; i++ {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Add("Authorization", "Bearer opaque-token")
+		w := httptest.NewRecorder()
+		auth.ServeHTTP(w, r)
+
+		// Assert
+		if w.Code != http.StatusOK {
+			t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+		}
+	}
+	if subject != "user-1" {
+		t.Fatalf("Expected the introspected sub claim user-1 but was %v", subject)
+	}
+	if requests != 1 {
+		t.Fatalf("Expected the token to be introspected once and cached but was introspected %v times", requests)
+	}
+}
+
+// TestJWTIntrospectionInactiveToken tests that StatusUnauthorized is returned for an inactive token
+func TestJWTIntrospectionInactiveToken(t *testing.T) {
+
+	// Arrange
+	requests := 0
+	server := newIntrospectionServer("opaque-token", &requests)
+	defer server.Close()
+	jwtOptions := JWTOptions{
+		IntrospectionURL:          server.URL,
+		IntrospectionClientID:     "client",
+		IntrospectionClientSecret: "secret",
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", "Bearer revoked-token")
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called as the token is inactive")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("StatusUnauthorized 401 expected but was %v", w.Code)
+	}
+}
+
+// TestJWTIntrospectionEndpointError tests that StatusUnauthorized is returned when the introspection endpoint rejects the request
+func TestJWTIntrospectionEndpointError(t *testing.T) {
+
+	// Arrange
+	requests := 0
+	server := newIntrospectionServer("opaque-token", &requests)
+	defer server.Close()
+	jwtOptions := JWTOptions{
+		IntrospectionURL:          server.URL,
+		IntrospectionClientID:     "client",
+		IntrospectionClientSecret: "wrong",
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", "Bearer opaque-token")
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called as introspection failed")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("StatusUnauthorized 401 expected but was %v", w.Code)
+	}
+}
@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// jwks is a cached JSON Web Key Set, fetched from a remote endpoint
+type jwks struct {
+	url             string
+	client          *http.Client
+	refreshInterval time.Duration
+	// missInterval is the minimum time between refreshes triggered by an unknown kid,
+	// so that tokens with made up kids can't be used to hammer the endpoint
+	missInterval time.Duration
+
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	// refreshing serialises refreshes, so concurrent requests don't each fetch the key set
+	refreshing sync.Mutex
+}
+
+// newJWKS creates the key set cache for the endpoint
+func newJWKS(url string, refreshInterval time.Duration) *jwks {
+	if refreshInterval == 0 {
+		refreshInterval = time.Hour
+	}
+	return &jwks{
+		url:             url,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		refreshInterval: refreshInterval,
+		missInterval:    10 * time.Second,
+	}
+}
+
+// key gets the public key with the kid, refreshing the cached key set when it's out of date or the kid is unknown.
+// The cached key is returned if the key set can't be refreshed
+func (k *jwks) key(kid string) (crypto.PublicKey, error) {
+	k.mu.RLock()
+	key, ok := k.keys[kid]
+	age := time.Since(k.fetchedAt)
+	k.mu.RUnlock()
+
+	if (ok && age > k.refreshInterval) || (!ok && age > k.missInterval) {
+		k.refresh(age)
+		k.mu.RLock()
+		if refreshed, found := k.keys[kid]; found {
+			key, ok = refreshed, true
+		}
+		k.mu.RUnlock()
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("No key found in the key set with kid %v", kid)
+	}
+	return key, nil
+}
+
+// refresh fetches the key set, unless another request refreshed it while waiting.
+// The cached keys are kept if fetching fails
+func (k *jwks) refresh(age time.Duration) {
+	k.refreshing.Lock()
+	defer k.refreshing.Unlock()
+
+	k.mu.RLock()
+	refreshedWhileWaiting := time.Since(k.fetchedAt) < age
+	k.mu.RUnlock()
+	if refreshedWhileWaiting {
+		return
+	}
+
+	keys, err := k.fetch()
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.fetchedAt = time.Now()
+	if err == nil {
+		k.keys = keys
+	}
+}
+
+// jsonWebKey is a single key in a JSON Web Key Set
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// fetch gets & parses the key set from the endpoint. Keys of unsupported types are skipped
+func (k *jwks) fetch() (map[string]crypto.PublicKey, error) {
+	resp, err := k.client.Get(k.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Fetching the key set failed with status %v", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// publicKey converts the JSON Web Key to a *rsa.PublicKey or *ecdsa.PublicKey
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("Unsupported curve %v", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("Unsupported key type %v", jwk.Kty)
+}
+
+// decodeBigInt decodes a base64url encoded big endian integer
+func decodeBigInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, errors.New("Missing key parameter")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
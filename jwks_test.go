@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// newJWKSServer creates a fake JWKS endpoint serving the public key with the kid. It counts the requests made to it
+func newJWKSServer(kid string, publicKey *rsa.PublicKey, requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": kid,
+				"n":   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+			}},
+		})
+	}))
+}
+
+// createJWTWithKid creates a RS256 token with the kid header
+func createJWTWithKid(t *testing.T, privateKey *rsa.PrivateKey, kid string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{})
+	token.Header["kid"] = kid
+	tokenString, err := token.SignedString(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "JWT " + tokenString
+}
+
+// TestJWTJWKSValidToken tests that a token signed by the current key in the key set is valid
+func TestJWTJWKSValidToken(t *testing.T) {
+
+	// Arrange
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := 0
+	server := newJWKSServer("key-1", &privateKey.PublicKey, &requests)
+	defer server.Close()
+	jwtOptions := JWTOptions{JWKSURL: server.URL}
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	for i := 0; i < 2; i++ {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Add("Authorization", createJWTWithKid(t, privateKey, "key-1"))
+		w := httptest.NewRecorder()
+		auth.ServeHTTP(w, r)
+
+		// Assert
+		if w.Code != http.StatusOK {
+			t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+		}
+	}
+	if requests != 1 {
+		t.Fatalf("Expected the key set to be fetched once and cached but was fetched %v times", requests)
+	}
+}
+
+// TestJWTJWKSUnknownKid tests that StatusUnauthorized is returned for a token whose kid isn't in the key set
+func TestJWTJWKSUnknownKid(t *testing.T) {
+
+	// Arrange
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := 0
+	server := newJWKSServer("key-1", &privateKey.PublicKey, &requests)
+	defer server.Close()
+	jwtOptions := JWTOptions{JWKSURL: server.URL}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", createJWTWithKid(t, privateKey, "key-2"))
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called as the kid is unknown")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("StatusUnauthorized 401 expected but was %v", w.Code)
+	}
+}
+
+// TestJWKSServesStaleKeys tests that cached keys are used when the key set can't be refreshed
+func TestJWKSServesStaleKeys(t *testing.T) {
+
+	// Arrange
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := 0
+	server := newJWKSServer("key-1", &privateKey.PublicKey, &requests)
+	keySet := newJWKS(server.URL, 1)
+	if _, err := keySet.key("key-1"); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+
+	// Act
+	key, err := keySet.key("key-1")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected the stale key to be used but got %v", err)
+	}
+	if key.(*rsa.PublicKey).N.Cmp(privateKey.PublicKey.N) != 0 {
+		t.Fatal("Expected the stale key to be the cached key")
+	}
+}
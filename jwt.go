@@ -2,9 +2,14 @@ package middleware
 
 import (
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
@@ -23,22 +28,87 @@ type JWTFunc func(context.Context, jwt.MapClaims) (context.Context, error)
 // be treated as an error.  An empty string should be returned in that case.
 type TokenExtractor func(authHeaderValue string) (string, error)
 
-// defaultTokenExtractor is the default token extractor. It recieves the Authorisation Header value. It expects it to container a value in format of JWT {token}
+// defaultTokenExtractor is the default token extractor. It recieves the Authorisation Header value.
+// It expects it to container a value in format of JWT {token} or Bearer {token}, where the scheme is case insensitive
 func defaultTokenExtractor(authHeaderValue string) (string, error) {
 	authHeaderParts := strings.Split(authHeaderValue, " ")
-	if len(authHeaderParts) != 2 || strings.ToLower(authHeaderParts[0]) != "jwt" {
-		return "", errors.New("Authorization header format must be JWT {token}")
+	if len(authHeaderParts) != 2 {
+		return "", errors.New("Authorization header format must be JWT {token} or Bearer {token}")
 	}
-	return authHeaderParts[1], nil
+	switch strings.ToLower(authHeaderParts[0]) {
+	case "jwt", "bearer":
+		return authHeaderParts[1], nil
+	}
+	return "", errors.New("Authorization header format must be JWT {token} or Bearer {token}")
 }
 
 // JWTOptions defines the user supplied JWT configuration options.
 type JWTOptions struct {
-	Secret   []byte
-	AuthFunc JWTFunc
-	// A function that extracts the token from the request
-	// Default: FromAuthHeader (i.e., from Authorization header as bearer token)
+	// Secret used to verify HMAC (HS256, HS384, HS512) signed tokens
+	Secret []byte
+	// PreviousSecret also verifies HMAC signed tokens during a secret rotation window, so that tokens signed
+	// before the rotation stay valid & users aren't all logged out. Remove it once the window has passed
+	PreviousSecret []byte
+	// PublicKey used to verify asymmetrically signed tokens.
+	// A *rsa.PublicKey verifies RS & PS signed tokens, a *ecdsa.PublicKey verifies ES signed tokens
+	PublicKey crypto.PublicKey
+	// AllowedAlgorithms are the signing algorithms tokens may use. Tokens declaring any other alg, including "none", are rejected
+	// Default: HS256, plus RS256 or ES256 when a *rsa.PublicKey or *ecdsa.PublicKey is configured
+	AllowedAlgorithms []string
+	// Leeway allows for clock skew between the token issuer & this server when validating the exp, nbf & iat claims
+	// Default: 0, no leeway
+	Leeway time.Duration
+	// ExpectedIssuer is compared against the token's iss claim when set. Default: the issuer isn't checked
+	ExpectedIssuer string
+	// ExpectedAudience must be one of the token's aud claim when set. Default: the audience isn't checked
+	ExpectedAudience string
+	// JWKSURL is the address of a JSON Web Key Set. Asymmetrically signed tokens are verified using the key matching their kid header.
+	// The key set is cached, and refreshed every JWKSRefreshInterval or when a token has an unknown kid.
+	// Cached keys continue to be used if the key set can't be refreshed. Default: PublicKey is used
+	JWKSURL string
+	// JWKSRefreshInterval is how often the cached key set is refreshed. Default: 1 hour
+	JWKSRefreshInterval time.Duration
+	// IntrospectionURL is the address of an OAuth 2.0 token introspection endpoint (RFC 7662).
+	// When set, tokens are treated as opaque & validated by posting them to the endpoint rather than verifying their signature.
+	// Inactive tokens are unauthorized. The claims of active tokens are those returned by the endpoint.
+	// Default: tokens are verified locally
+	IntrospectionURL string
+	// IntrospectionClientID & IntrospectionClientSecret are the client credentials used to authenticate with the introspection endpoint
+	IntrospectionClientID     string
+	IntrospectionClientSecret string
+	// IntrospectionCacheTTL is how long an introspection result is cached. Active tokens are never cached beyond their exp claim
+	// Default: 30 seconds
+	IntrospectionCacheTTL time.Duration
+	AuthFunc              JWTFunc
+	// A function that extracts the token from the Authorization header value.
+	// The request is unauthorized if it returns an error
+	// Default: accepts JWT {token} & Bearer {token}
 	Extractor TokenExtractor
+	// CookieName reads the token from the named cookie rather than the Authorization header.
+	// The cookie's value is the token itself, without a scheme. Default: the Authorization header is used
+	CookieName string
+	// CookieFallbackToHeader reads the token from the Authorization header when the cookie is missing
+	// Default: false, a missing cookie is unauthorized
+	CookieFallbackToHeader bool
+	// QueryParam also reads the token from the named query parameter, e.g. access_token, when the request has no
+	// Authorization header or cookie, for WebSocket handshakes & links which can't set headers.
+	// Tokens in URLs are less secure: they end up in server & proxy logs, browser history & Referer headers,
+	// so use short lived tokens. Default: the query string isn't read
+	QueryParam string
+	// TokenSources are tried in order until one yields a token, e.g. []TokenSource{FromHeader(nil), FromCookie("token")}
+	// to accept the header from APIs & a cookie from the web. The request is only unauthorized if none do.
+	// It takes precedence over Extractor, CookieName & QueryParam. Default: the Authorization header, or the cookie when CookieName is set
+	TokenSources []TokenSource
+	// OnError writes the response when authentication fails, e.g. to write a JSON error envelope.
+	// It's given the Extractor's error, the token's validation error or the AuthFunc's error
+	// Default: an empty StatusUnauthorized (401) response, or StatusForbidden (403) when the AuthFunc returns ErrForbidden
+	OnError AuthErrorFunc
+	// OnSuccess is called, e.g. for auditing or metrics, with the request & the validated claims when authentication succeeds,
+	// right before the next handler
+	OnSuccess func(r *http.Request, claims jwt.MapClaims)
+	// Optional allows anonymous requests, without a token, through to the next handler without claims, so GetClaims returns nil.
+	// Requests with an invalid token are still unauthorized. Default: false, a token is required
+	Optional bool
 }
 
 // JWT is middleware which handles authentication for JsonWebTokens
@@ -48,47 +118,343 @@ func JWT(options JWTOptions) Middleware {
 		options.Extractor = defaultTokenExtractor
 	}
 
+	if options.AllowedAlgorithms == nil {
+		options.AllowedAlgorithms = defaultAlgorithms(options)
+	}
+
+	tokenSource := headerTokenSource(options.Extractor)
+	if options.CookieName != "" {
+		tokenSource = cookieTokenSource(options.CookieName, options.CookieFallbackToHeader, tokenSource)
+	}
+	if options.QueryParam != "" {
+		tokenSource = firstTokenSource([]TokenSource{TokenSource(tokenSource), FromQuery(options.QueryParam)})
+	}
+	if len(options.TokenSources) > 0 {
+		tokenSource = firstTokenSource(options.TokenSources)
+	}
+
+	var keySet *jwks
+	if options.JWKSURL != "" {
+		keySet = newJWKS(options.JWKSURL, options.JWKSRefreshInterval)
+	}
+
+	var tokenIntrospector *introspector
+	if options.IntrospectionURL != "" {
+		tokenIntrospector = newIntrospector(options.IntrospectionURL, options.IntrospectionClientID, options.IntrospectionClientSecret, options.IntrospectionCacheTTL)
+	}
+
 	return func(next http.Handler) http.Handler {
 		authenticater := jwtAuth{
 			secret:           options.Secret,
+			previousSecret:   options.PreviousSecret,
+			publicKey:        options.PublicKey,
+			jwks:             keySet,
+			introspector:     tokenIntrospector,
+			algorithms:       options.AllowedAlgorithms,
+			leeway:           options.Leeway,
+			issuer:           options.ExpectedIssuer,
+			audience:         options.ExpectedAudience,
 			userSuppliedFunc: options.AuthFunc,
-			tokenExtractor:   options.Extractor,
 		}
 
-		return Auth(authenticater.authenticate)(next)
+		var onSuccess func(r *http.Request)
+		if options.OnSuccess != nil {
+			onSuccess = func(r *http.Request) {
+				options.OnSuccess(r, GetClaims(r.Context()))
+			}
+		}
+		authenticated := authMiddleware(tokenSource, authenticater.authenticate, options.OnError, onSuccess)(next)
+		if !options.Optional {
+			return authenticated
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token, err := tokenSource(r); err == nil && token == "" {
+				// anonymous
+				next.ServeHTTP(w, r)
+				return
+			}
+			authenticated.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TokenSource reads the token from the request, returning "" if the request doesn't have one
+type TokenSource func(r *http.Request) (string, error)
+
+// FromHeader reads the token from the Authorization header using the TokenExtractor.
+// A nil extractor accepts JWT {token} & Bearer {token}
+func FromHeader(extractor TokenExtractor) TokenSource {
+	if extractor == nil {
+		extractor = defaultTokenExtractor
+	}
+	return TokenSource(headerTokenSource(extractor))
+}
+
+// FromCookie reads the token from the named cookie. The cookie's value is the token itself, without a scheme
+func FromCookie(name string) TokenSource {
+	return func(r *http.Request) (string, error) {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return "", nil
+		}
+		return cookie.Value, nil
+	}
+}
+
+// FromQuery reads the token from the named query parameter, e.g. access_token.
+// See JWTOptions.QueryParam for the security caveats of tokens in URLs
+func FromQuery(param string) TokenSource {
+	return func(r *http.Request) (string, error) {
+		return r.URL.Query().Get(param), nil
+	}
+}
+
+// firstTokenSource tries the token sources in order, returning the first token found.
+// If none find a token the first source's error, if any, is returned
+func firstTokenSource(sources []TokenSource) credentialsFunc {
+	return func(r *http.Request) (string, error) {
+		var firstErr error
+		for _, source := range sources {
+			token, err := source(r)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			if token != "" {
+				return token, nil
+			}
+		}
+		return "", firstErr
+	}
+}
+
+// headerTokenSource reads the token from the Authorization header using the TokenExtractor
+func headerTokenSource(extractor TokenExtractor) credentialsFunc {
+	return func(r *http.Request) (string, error) {
+		authHeaderValue := r.Header.Get("Authorization")
+		if authHeaderValue == "" {
+			return "", nil
+		}
+		return extractor(authHeaderValue)
+	}
+}
+
+// cookieTokenSource reads the token from the named cookie, optionally falling back to the header token source
+func cookieTokenSource(name string, fallbackToHeader bool, header credentialsFunc) credentialsFunc {
+	return func(r *http.Request) (string, error) {
+		cookie, err := r.Cookie(name)
+		if err == nil && cookie.Value != "" {
+			return cookie.Value, nil
+		}
+		if fallbackToHeader {
+			return header(r)
+		}
+		return "", nil
 	}
 }
 
-// jwtAuth is the private version of JWTOptions which contains the authentication function passed to Auth middleware
+// jwtAuth is the private version of JWTOptions which contains the authentication function passed to the auth middleware
 type jwtAuth struct {
 	secret           []byte
+	previousSecret   []byte
+	publicKey        crypto.PublicKey
+	jwks             *jwks
+	introspector     *introspector
+	algorithms       []string
+	leeway           time.Duration
+	issuer           string
+	audience         string
 	userSuppliedFunc JWTFunc
-	tokenExtractor   TokenExtractor
 }
 
-func (auth jwtAuth) authenticate(ctx context.Context, authHeaderValue string) (context.Context, error) {
+func (auth jwtAuth) authenticate(ctx context.Context, tokenString string) (context.Context, error) {
 
-	tokenString, err := auth.tokenExtractor(authHeaderValue)
-	if err != nil {
-		return ctx, err
+	if auth.introspector != nil {
+		claims, err := auth.introspector.introspect(tokenString)
+		if err != nil {
+			return ctx, err
+		}
+		return auth.authorize(ctx, claims)
 	}
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return auth.secret, nil
-	})
+	// time based claims are validated below, allowing for the leeway
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.Parse(tokenString, auth.verificationKey)
+	if len(auth.previousSecret) > 0 && isSignatureInvalid(err) {
+		token, err = parser.Parse(tokenString, auth.previousVerificationKey)
+	}
 	if err != nil {
 		return ctx, err
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		if err := auth.validateTimeClaims(claims, time.Now()); err != nil {
+			return ctx, err
+		}
 		// fmt.Printf("%+v\n", token)
 		// fmt.Printf("%+v\n", claims)
-		if auth.userSuppliedFunc != nil {
-			return auth.userSuppliedFunc(ctx, claims)
-		}
-		return ctx, nil
+		return auth.authorize(ctx, claims)
 	}
 
 	// fmt.Println(err)
 	return ctx, err
 }
+
+// authorize checks the issuer & audience of the validated claims, adds them to the context & calls the user supplied func
+func (auth jwtAuth) authorize(ctx context.Context, claims jwt.MapClaims) (context.Context, error) {
+	if err := auth.validateIssuerAndAudience(claims); err != nil {
+		return ctx, err
+	}
+	ctx = setClaims(ctx, claims)
+	if auth.userSuppliedFunc != nil {
+		return auth.userSuppliedFunc(ctx, claims)
+	}
+	return ctx, nil
+}
+
+// validateTimeClaims checks the exp, nbf & iat claims against the time now, allowing for the leeway
+func (auth jwtAuth) validateTimeClaims(claims jwt.MapClaims, now time.Time) error {
+	leeway := int64(auth.leeway / time.Second)
+	if !claims.VerifyExpiresAt(now.Unix()-leeway, false) {
+		return errors.New("Token is expired")
+	}
+	if !claims.VerifyNotBefore(now.Unix()+leeway, false) {
+		return errors.New("Token is not valid yet")
+	}
+	if !claims.VerifyIssuedAt(now.Unix()+leeway, false) {
+		return errors.New("Token used before issued")
+	}
+	return nil
+}
+
+// validateIssuerAndAudience checks the iss & aud claims against the expected values, if there are any
+func (auth jwtAuth) validateIssuerAndAudience(claims jwt.MapClaims) error {
+	if auth.issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != auth.issuer {
+			return errors.New("Token has an unexpected issuer")
+		}
+	}
+	if auth.audience != "" && !hasAudience(claims["aud"], auth.audience) {
+		return errors.New("Token has an unexpected audience")
+	}
+	return nil
+}
+
+// hasAudience checks if the aud claim, which is either a string or an array of strings, contains the audience
+func hasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// claims context key
+var claimsKey = &contextKey{"Claims"}
+
+// setClaims creates a child context with the validated claims value
+func setClaims(ctx context.Context, claims jwt.MapClaims) context.Context {
+	return context.WithValue(ctx, claimsKey, claims)
+}
+
+// GetClaims gets the validated JWT claims stored in the context, or nil if there aren't any
+func GetClaims(ctx context.Context) jwt.MapClaims {
+	claims, _ := ctx.Value(claimsKey).(jwt.MapClaims)
+	return claims
+}
+
+// defaultAlgorithms returns the signing algorithms allowed when the user doesn't supply any
+func defaultAlgorithms(options JWTOptions) []string {
+	algorithms := []string{"HS256"}
+	switch {
+	case options.JWKSURL != "":
+		algorithms = append(algorithms, "RS256", "ES256")
+	case isRSAKey(options.PublicKey):
+		algorithms = append(algorithms, "RS256")
+	case isECDSAKey(options.PublicKey):
+		algorithms = append(algorithms, "ES256")
+	}
+	return algorithms
+}
+
+// isRSAKey checks if the public key is a RSA key
+func isRSAKey(publicKey crypto.PublicKey) bool {
+	_, ok := publicKey.(*rsa.PublicKey)
+	return ok
+}
+
+// isECDSAKey checks if the public key is a ECDSA key
+func isECDSAKey(publicKey crypto.PublicKey) bool {
+	_, ok := publicKey.(*ecdsa.PublicKey)
+	return ok
+}
+
+// verificationKey picks the key used to verify the token based on its signing algorithm.
+// Tokens are rejected when their algorithm isn't allowed or when no key of the matching type is configured,
+// so that e.g. a HMAC signed token can never be verified using the bytes of a RSA public key
+func (auth jwtAuth) verificationKey(token *jwt.Token) (interface{}, error) {
+	if !auth.isAllowedAlgorithm(token.Method.Alg()) {
+		return nil, fmt.Errorf("Signing algorithm %v isn't allowed", token.Method.Alg())
+	}
+
+	publicKey := auth.publicKey
+	if _, isHMAC := token.Method.(*jwt.SigningMethodHMAC); !isHMAC && auth.jwks != nil {
+		kid, _ := token.Header["kid"].(string)
+		key, err := auth.jwks.key(kid)
+		if err != nil {
+			return nil, err
+		}
+		publicKey = key
+	}
+
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if len(auth.secret) > 0 {
+			return auth.secret, nil
+		}
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if key, ok := publicKey.(*rsa.PublicKey); ok {
+			return key, nil
+		}
+	case *jwt.SigningMethodECDSA:
+		if key, ok := publicKey.(*ecdsa.PublicKey); ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("No key configured to verify %v signed tokens", token.Header["alg"])
+}
+
+// previousVerificationKey returns the previous secret to verify HMAC signed tokens during a secret rotation
+func (auth jwtAuth) previousVerificationKey(token *jwt.Token) (interface{}, error) {
+	if !auth.isAllowedAlgorithm(token.Method.Alg()) {
+		return nil, fmt.Errorf("Signing algorithm %v isn't allowed", token.Method.Alg())
+	}
+	if _, isHMAC := token.Method.(*jwt.SigningMethodHMAC); !isHMAC {
+		return nil, fmt.Errorf("No previous key configured to verify %v signed tokens", token.Header["alg"])
+	}
+	return auth.previousSecret, nil
+}
+
+// isSignatureInvalid checks if the token failed to parse because its signature didn't verify
+func isSignatureInvalid(err error) bool {
+	validationErr, ok := err.(*jwt.ValidationError)
+	return ok && validationErr.Errors&jwt.ValidationErrorSignatureInvalid != 0
+}
+
+// isAllowedAlgorithm checks if the signing algorithm is in the allow list
+func (auth jwtAuth) isAllowedAlgorithm(alg string) bool {
+	for _, allowed := range auth.algorithms {
+		if alg == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,11 @@ package middleware
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -235,3 +240,773 @@ func createJWTWithExpiration(t *testing.T, secret []byte, scheme string, expirat
 	}
 	return scheme + " " + tokenString
 }
+
+func TestJWTValidRS256Token(t *testing.T) {
+
+	// Arrange
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtOptions := JWTOptions{PublicKey: &privateKey.PublicKey}
+	token := createSignedJWT(t, jwt.SigningMethodRS256, privateKey, "JWT")
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", token)
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
+
+func TestJWTValidES256Token(t *testing.T) {
+
+	// Arrange
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtOptions := JWTOptions{PublicKey: &privateKey.PublicKey}
+	token := createSignedJWT(t, jwt.SigningMethodES256, privateKey, "JWT")
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", token)
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
+
+// TestJWTHMACTokenWithPublicKey tests that a HMAC signed token can't be verified using a RSA public key
+func TestJWTHMACTokenWithPublicKey(t *testing.T) {
+
+	// Arrange
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtOptions := JWTOptions{PublicKey: &privateKey.PublicKey}
+	token := createValidJWT(t, publicKeyBytes, "JWT")
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", token)
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called as the token is HMAC signed")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("StatusUnauthorized 401 expected but was %v", w.Code)
+	}
+}
+
+// TestJWTRS256TokenWithSecret tests that a RSA signed token isn't accepted when only a HMAC secret is configured
+func TestJWTRS256TokenWithSecret(t *testing.T) {
+
+	// Arrange
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwtOptions := JWTOptions{Secret: []byte("SECRET_SSSHHHHHHH")}
+	token := createSignedJWT(t, jwt.SigningMethodRS256, privateKey, "JWT")
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", token)
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called as the token is RSA signed")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("StatusUnauthorized 401 expected but was %v", w.Code)
+	}
+}
+
+func createSignedJWT(t *testing.T, method jwt.SigningMethod, key interface{}, scheme string) string {
+	claims := jwt.MapClaims{}
+	tokenString, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return scheme + " " + tokenString
+}
+
+// TestJWTNoneAlgorithm tests that an unsigned token using the "none" algorithm is rejected
+func TestJWTNoneAlgorithm(t *testing.T) {
+
+	// Arrange
+	secret := []byte("SECRET_SSSHHHHHHH")
+	jwtOptions := JWTOptions{Secret: secret}
+	token := createSignedJWT(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "JWT")
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", token)
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called as the token isn't signed")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("StatusUnauthorized 401 expected but was %v", w.Code)
+	}
+}
+
+// TestJWTAlgorithmNotAllowed tests that a token signed with an algorithm outside the allow list is rejected
+func TestJWTAlgorithmNotAllowed(t *testing.T) {
+
+	// Arrange
+	secret := []byte("SECRET_SSSHHHHHHH")
+	jwtOptions := JWTOptions{Secret: secret, AllowedAlgorithms: []string{"HS512"}}
+	token := createValidJWT(t, secret, "JWT")
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", token)
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called as HS256 isn't allowed")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("StatusUnauthorized 401 expected but was %v", w.Code)
+	}
+}
+
+// TestJWTGetClaims tests that the validated claims can be read from the context by the next handler
+func TestJWTGetClaims(t *testing.T) {
+
+	// Arrange
+	secret := []byte("SECRET_SSSHHHHHHH")
+	jwtOptions := JWTOptions{Secret: secret}
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "test@test.com"}).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", "JWT "+tokenString)
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sub := GetClaims(r.Context())["sub"]; sub != "test@test.com" {
+			t.Fatalf("Expected the sub claim to be test@test.com but was %v", sub)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
+
+// TestGetClaimsNoClaims tests that GetClaims returns nil rather than panicking when there are no claims
+func TestGetClaimsNoClaims(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+
+	// Act
+	claims := GetClaims(r.Context())
+
+	// Assert
+	if claims != nil {
+		t.Fatalf("Expected no claims but got %v", claims)
+	}
+}
+
+// TestJWTCookieToken tests that the token is read from the configured cookie
+func TestJWTCookieToken(t *testing.T) {
+
+	// Arrange
+	secret := []byte("SECRET_SSSHHHHHHH")
+	jwtOptions := JWTOptions{Secret: secret, CookieName: "token"}
+	token := strings.TrimPrefix(createValidJWT(t, secret, "JWT"), "JWT ")
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "token", Value: token})
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
+
+// TestJWTCookieMissing tests that StatusUnauthorized is returned when the cookie is missing, even if the header is set
+func TestJWTCookieMissing(t *testing.T) {
+
+	// Arrange
+	secret := []byte("SECRET_SSSHHHHHHH")
+	jwtOptions := JWTOptions{Secret: secret, CookieName: "token"}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", createValidJWT(t, secret, "JWT"))
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("StatusUnauthorized 401 expected but was %v", w.Code)
+	}
+}
+
+// TestJWTCookieFallbackToHeader tests that the header is used when the cookie is missing and fallback is enabled
+func TestJWTCookieFallbackToHeader(t *testing.T) {
+
+	// Arrange
+	secret := []byte("SECRET_SSSHHHHHHH")
+	jwtOptions := JWTOptions{Secret: secret, CookieName: "token", CookieFallbackToHeader: true}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", createValidJWT(t, secret, "JWT"))
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
+
+// TestJWTExpiredTokenWithinLeeway tests that a token which expired within the leeway is valid
+func TestJWTExpiredTokenWithinLeeway(t *testing.T) {
+
+	// Arrange
+	secret := []byte("SECRET_SSSHHHHHHH")
+	jwtOptions := JWTOptions{Secret: secret, Leeway: 10 * time.Second}
+	r, _ := http.NewRequest("GET", "/", nil)
+	token := createJWTWithExpiration(t, secret, "JWT", time.Now().Add(-5*time.Second))
+	r.Header.Add("Authorization", token)
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
+
+// TestJWTExpiredTokenNoLeeway tests that a token which expired seconds ago is invalid without a leeway
+func TestJWTExpiredTokenNoLeeway(t *testing.T) {
+
+	// Arrange
+	secret := []byte("SECRET_SSSHHHHHHH")
+	jwtOptions := JWTOptions{Secret: secret}
+	r, _ := http.NewRequest("GET", "/", nil)
+	token := createJWTWithExpiration(t, secret, "JWT", time.Now().Add(-5*time.Second))
+	r.Header.Add("Authorization", token)
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called as the token is expired")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("StatusUnauthorized 401 expected but was %v", w.Code)
+	}
+}
+
+// TestJWTNotBeforeWithinLeeway tests that a token which isn't valid yet is accepted within the leeway
+func TestJWTNotBeforeWithinLeeway(t *testing.T) {
+
+	// Arrange
+	secret := []byte("SECRET_SSSHHHHHHH")
+	jwtOptions := JWTOptions{Secret: secret, Leeway: 10 * time.Second}
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"nbf": time.Now().Add(5 * time.Second).Unix()}).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", "JWT "+tokenString)
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
+
+// TestJWTMatchingAudienceArray tests that a token is valid when the expected audience is in its aud array
+func TestJWTMatchingAudienceArray(t *testing.T) {
+
+	// Arrange
+	secret := []byte("SECRET_SSSHHHHHHH")
+	jwtOptions := JWTOptions{Secret: secret, ExpectedIssuer: "https://auth.example.com", ExpectedAudience: "api"}
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": "https://auth.example.com",
+		"aud": []string{"web", "api"},
+	}).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", "JWT "+tokenString)
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
+
+// TestJWTMatchingAudienceString tests that a token is valid when its aud string is the expected audience
+func TestJWTMatchingAudienceString(t *testing.T) {
+
+	// Arrange
+	secret := []byte("SECRET_SSSHHHHHHH")
+	jwtOptions := JWTOptions{Secret: secret, ExpectedAudience: "api"}
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"aud": "api"}).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", "JWT "+tokenString)
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
+
+// TestJWTMismatchedIssuer tests that StatusUnauthorized is returned when the token's issuer isn't the expected one
+func TestJWTMismatchedIssuer(t *testing.T) {
+
+	// Arrange
+	secret := []byte("SECRET_SSSHHHHHHH")
+	jwtOptions := JWTOptions{Secret: secret, ExpectedIssuer: "https://auth.example.com"}
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iss": "https://evil.example.com"}).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", "JWT "+tokenString)
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called as the issuer doesn't match")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("StatusUnauthorized 401 expected but was %v", w.Code)
+	}
+}
+
+// TestJWTDefaultExtractorBearer tests that the default extractor accepts the Bearer scheme case insensitively
+func TestJWTDefaultExtractorBearer(t *testing.T) {
+
+	for _, scheme := range []string{"Bearer", "bearer", "BEARER", "jwt"} {
+
+		// Arrange
+		secret := []byte("SECRET_SSSHHHHHHH")
+		jwtOptions := JWTOptions{Secret: secret}
+		token := createValidJWT(t, secret, scheme)
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Add("Authorization", token)
+		w := httptest.NewRecorder()
+		auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		// Act
+		auth.ServeHTTP(w, r)
+
+		// Assert
+		if w.Code != http.StatusOK {
+			t.Fatalf("StatusOK 200 expected for the %s scheme but was %v", scheme, w.Code)
+		}
+	}
+}
+
+// TestJWTDefaultExtractorUnknownScheme tests that the default extractor rejects other schemes
+func TestJWTDefaultExtractorUnknownScheme(t *testing.T) {
+
+	// Arrange
+	secret := []byte("SECRET_SSSHHHHHHH")
+	jwtOptions := JWTOptions{Secret: secret}
+	token := createValidJWT(t, secret, "Basic")
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", token)
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("StatusUnauthorized 401 expected but was %v", w.Code)
+	}
+}
+
+// TestJWTOnErrorExtractorError tests that the OnError handler writes the response, & is given the Extractor's error
+func TestJWTOnErrorExtractorError(t *testing.T) {
+
+	// Arrange
+	secret := []byte("SECRET_SSSHHHHHHH")
+	extractorErr := errors.New("Malformed Authorization header")
+	var authErr error
+	jwtOptions := JWTOptions{
+		Secret: secret,
+		Extractor: func(authHeaderValue string) (string, error) {
+			return "", extractorErr
+		},
+		OnError: func(w http.ResponseWriter, r *http.Request, err error) {
+			authErr = err
+			jsonAuthError(w, r, err)
+		},
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", createValidJWT(t, secret, "JWT"))
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("StatusForbidden 403 expected but was %v", w.Code)
+	}
+	if authErr != extractorErr {
+		t.Fatalf("Expected the extractor's error but was %v", authErr)
+	}
+	if body := strings.TrimSpace(w.Body.String()); body != `{"code":"unauthorized","message":"Malformed Authorization header"}` {
+		t.Fatalf("Expected a JSON error body but was %v", body)
+	}
+}
+
+// TestJWTOnErrorParseError tests that the OnError handler is given the token's parsing error
+func TestJWTOnErrorParseError(t *testing.T) {
+
+	// Arrange
+	var authErr error
+	jwtOptions := JWTOptions{
+		Secret: []byte("SECRET_SSSHHHHHHH"),
+		OnError: func(w http.ResponseWriter, r *http.Request, err error) {
+			authErr = err
+			w.WriteHeader(http.StatusUnauthorized)
+		},
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", createValidJWT(t, []byte("WRONG_SECRET"), "JWT"))
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if _, ok := authErr.(*jwt.ValidationError); !ok {
+		t.Fatalf("Expected a *jwt.ValidationError but was %v", authErr)
+	}
+}
+
+// TestJWTOnErrorAuthFuncError tests that the OnError handler is given the AuthFunc's error
+func TestJWTOnErrorAuthFuncError(t *testing.T) {
+
+	// Arrange
+	secret := []byte("SECRET_SSSHHHHHHH")
+	authFuncErr := errors.New("User is disabled")
+	var authErr error
+	jwtOptions := JWTOptions{
+		Secret: secret,
+		AuthFunc: func(ctx context.Context, claims jwt.MapClaims) (context.Context, error) {
+			return ctx, authFuncErr
+		},
+		OnError: func(w http.ResponseWriter, r *http.Request, err error) {
+			authErr = err
+			w.WriteHeader(http.StatusUnauthorized)
+		},
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", createValidJWT(t, secret, "JWT"))
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if authErr != authFuncErr {
+		t.Fatalf("Expected the AuthFunc's error but was %v", authErr)
+	}
+}
+
+// TestJWTSecretRotation tests that tokens signed with either the current or the previous secret are valid, & tokens signed with neither aren't
+func TestJWTSecretRotation(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		secret []byte
+		status int
+	}{
+		{"current", []byte("NEW_SECRET_SSSHHHHHHH"), http.StatusOK},
+		{"previous", []byte("OLD_SECRET_SSSHHHHHHH"), http.StatusOK},
+		{"unknown", []byte("WRONG_SECRET"), http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+
+		// Arrange
+		jwtOptions := JWTOptions{Secret: []byte("NEW_SECRET_SSSHHHHHHH"), PreviousSecret: []byte("OLD_SECRET_SSSHHHHHHH")}
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Add("Authorization", createValidJWT(t, test.secret, "JWT"))
+		w := httptest.NewRecorder()
+		auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		// Act
+		auth.ServeHTTP(w, r)
+
+		// Assert
+		if w.Code != test.status {
+			t.Fatalf("Status %v expected for a token signed with the %s secret but was %v", test.status, test.name, w.Code)
+		}
+	}
+}
+
+// TestJWTOptionalAnonymous tests that in optional mode a request without a token reaches the next handler without claims
+func TestJWTOptionalAnonymous(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	auth := JWT(JWTOptions{Secret: []byte("SECRET_SSSHHHHHHH"), Optional: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if claims := GetClaims(r.Context()); claims != nil {
+			t.Fatalf("Expected no claims for an anonymous request but was %v", claims)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
+
+// TestJWTOptionalInvalidToken tests that in optional mode a request with an invalid token is still unauthorized
+func TestJWTOptionalInvalidToken(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", "JWT not.a.token")
+	w := httptest.NewRecorder()
+	auth := JWT(JWTOptions{Secret: []byte("SECRET_SSSHHHHHHH"), Optional: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("StatusUnauthorized 401 expected but was %v", w.Code)
+	}
+}
+
+// TestJWTTokenSourcesFallback tests that the token sources are tried in order, so a cookie is used when the header is absent
+func TestJWTTokenSourcesFallback(t *testing.T) {
+
+	// Arrange
+	secret := []byte("SECRET_SSSHHHHHHH")
+	jwtOptions := JWTOptions{Secret: secret, TokenSources: []TokenSource{FromHeader(nil), FromCookie("token"), FromQuery("access_token")}}
+	token := strings.TrimPrefix(createValidJWT(t, secret, "JWT"), "JWT ")
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "token", Value: token})
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
+
+// TestJWTTokenSourcesNoneFound tests that StatusUnauthorized is returned when none of the token sources yield a token
+func TestJWTTokenSourcesNoneFound(t *testing.T) {
+
+	// Arrange
+	secret := []byte("SECRET_SSSHHHHHHH")
+	jwtOptions := JWTOptions{Secret: secret, TokenSources: []TokenSource{FromHeader(nil), FromCookie("token")}}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", "Basic dXNlcjpwYXNz")
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("StatusUnauthorized 401 expected but was %v", w.Code)
+	}
+}
+
+// TestJWTQueryParam tests that the token is read from the configured query parameter
+func TestJWTQueryParam(t *testing.T) {
+
+	// Arrange
+	secret := []byte("SECRET_SSSHHHHHHH")
+	jwtOptions := JWTOptions{Secret: secret, QueryParam: "access_token"}
+	token := strings.TrimPrefix(createValidJWT(t, secret, "JWT"), "JWT ")
+	r, _ := http.NewRequest("GET", "/ws?access_token="+token, nil)
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
+
+// TestJWTQueryParamInvalid tests that StatusUnauthorized is returned when the query parameter's token is invalid
+func TestJWTQueryParamInvalid(t *testing.T) {
+
+	// Arrange
+	jwtOptions := JWTOptions{Secret: []byte("SECRET_SSSHHHHHHH"), QueryParam: "access_token"}
+	token := strings.TrimPrefix(createValidJWT(t, []byte("WRONG_SECRET"), "JWT"), "JWT ")
+	r, _ := http.NewRequest("GET", "/ws?access_token="+token, nil)
+	w := httptest.NewRecorder()
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("StatusUnauthorized 401 expected but was %v", w.Code)
+	}
+}
+
+// TestJWTOnSuccess tests that the OnSuccess callback is given the validated claims before the next handler
+func TestJWTOnSuccess(t *testing.T) {
+
+	// Arrange
+	secret := []byte("SECRET_SSSHHHHHHH")
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "test@test.com"}).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", "JWT "+tokenString)
+	w := httptest.NewRecorder()
+	var subject interface{}
+	jwtOptions := JWTOptions{Secret: secret, OnSuccess: func(r *http.Request, claims jwt.MapClaims) {
+		subject = claims["sub"]
+	}}
+	auth := JWT(jwtOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subject == nil {
+			t.Fatal("Expected OnSuccess to be called before the next handler")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	auth.ServeHTTP(w, r)
+
+	// Assert
+	if subject != "test@test.com" {
+		t.Fatalf("Expected OnSuccess to receive the sub claim test@test.com but was %v", subject)
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+)
+
+// LogEntry is the access log entry of a request, as recorded by Logger
+type LogEntry struct {
+	Method   string
+	Path     string
+	Status   int
+	Duration time.Duration
+	Bytes    int
+}
+
+// Logger middleware records a structured access log entry for each request.
+// The log function is called, with the request's method, path, response status & size and how long it took, after the next handler returns
+func Logger(log func(entry LogEntry)) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rw := NewResponseWriter(w)
+			next.ServeHTTP(rw, r)
+
+			status := rw.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			log(LogEntry{
+				Method:   r.Method,
+				Path:     r.URL.Path,
+				Status:   status,
+				Duration: time.Since(start),
+				Bytes:    rw.BytesWritten(),
+			})
+		})
+	}
+}
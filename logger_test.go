@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestLogger tests that the log entry records the status & size of the response written
+func TestLogger(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/users", nil)
+	w := httptest.NewRecorder()
+	var entry LogEntry
+	handler := Logger(func(e LogEntry) { entry = e })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":1}`))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusCreated || w.Body.String() != `{"id":1}` {
+		t.Fatalf("Expected the response to be passed through but was %v %s", w.Code, w.Body.String())
+	}
+	if entry.Status != http.StatusCreated {
+		t.Fatalf("Expected the logged status to be StatusCreated 201 but was %v", entry.Status)
+	}
+	if entry.Bytes != len(`{"id":1}`) {
+		t.Fatalf("Expected the logged size to be %v but was %v", len(`{"id":1}`), entry.Bytes)
+	}
+	if entry.Method != "POST" || entry.Path != "/users" || entry.Duration <= 0 {
+		t.Fatalf("Expected the request to be logged but was %+v", entry)
+	}
+}
+
+// TestLoggerImplicitStatus tests that a response without an explicit status is logged as StatusOK (200)
+func TestLoggerImplicitStatus(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/users", nil)
+	w := httptest.NewRecorder()
+	var entry LogEntry
+	handler := Logger(func(e LogEntry) { entry = e })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if entry.Status != http.StatusOK || entry.Bytes != 2 {
+		t.Fatalf("Expected StatusOK 200 & 2 bytes to be logged but was %v & %v", entry.Status, entry.Bytes)
+	}
+}
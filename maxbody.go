@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+)
+
+// MaxBodySizeOptions defines the user supplied MaxBodySize configuration options.
+type MaxBodySizeOptions struct {
+	// Limit is the maximum number of request body bytes. Required
+	Limit int64
+	// Status is written when the body exceeds the limit. Default: StatusRequestEntityTooLarge (413)
+	Status int
+	// Message is the response body written when the body exceeds the limit. Default: the status text
+	Message string
+}
+
+// MaxBodySize middleware limits the size of request bodies to n bytes, protecting handlers from exhausting memory on large uploads.
+// Requests whose Content-Length exceeds the limit are rejected with a StatusRequestEntityTooLarge (413) without calling the next handler.
+// Otherwise the body is wrapped with http.MaxBytesReader, so reading beyond the limit returns an error, & the 413 is written
+// if the handler hasn't written a response of its own
+func MaxBodySize(n int64) Middleware {
+	return MaxBodySizeWithOptions(MaxBodySizeOptions{Limit: n})
+}
+
+// MaxBodySizeWithOptions middleware limits the size of request bodies, like MaxBodySize, using the user supplied options
+func MaxBodySizeWithOptions(opts MaxBodySizeOptions) Middleware {
+	if opts.Status == 0 {
+		opts.Status = http.StatusRequestEntityTooLarge
+	}
+	if opts.Message == "" {
+		opts.Message = http.StatusText(opts.Status)
+	}
+	tooLarge := func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Connection", "close")
+		w.WriteHeader(opts.Status)
+		w.Write([]byte(opts.Message))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > opts.Limit {
+				tooLarge(w)
+				return
+			}
+			if r.Body == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body := &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, opts.Limit), limit: opts.Limit}
+			r.Body = body
+			rw := NewResponseWriter(w)
+			next.ServeHTTP(rw, r)
+
+			if body.exceeded && rw.Status() == 0 {
+				tooLarge(w)
+			}
+		})
+	}
+}
+
+// limitedBody wraps the http.MaxBytesReader to record whether the limit was exceeded
+type limitedBody struct {
+	io.ReadCloser
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+// Read wraps the http.MaxBytesReader's Read, recording the limit was exceeded if it errors once all the allowed bytes are read
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err != nil && err != io.EOF && b.read >= b.limit {
+		b.exceeded = true
+	}
+	return n, err
+}
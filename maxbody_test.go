@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestMaxBodySizeContentLength tests that a request declaring a body larger than the limit is rejected without calling the next handler
+func TestMaxBodySizeContentLength(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/upload", strings.NewReader(strings.Repeat("a", 20)))
+	w := httptest.NewRecorder()
+	handler := MaxBodySize(10)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("StatusRequestEntityTooLarge 413 expected but was %v", w.Code)
+	}
+}
+
+// TestMaxBodySizeRead tests that reading a body larger than the limit errors & the configured status & message are written
+func TestMaxBodySizeRead(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/upload", ioutil.NopCloser(strings.NewReader(strings.Repeat("a", 20))))
+	r.ContentLength = -1
+	w := httptest.NewRecorder()
+	options := MaxBodySizeOptions{Limit: 10, Status: http.StatusBadRequest, Message: "Upload too large"}
+	handler := MaxBodySizeWithOptions(options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := ioutil.ReadAll(r.Body); err == nil {
+			t.Fatal("Expected reading beyond the limit to error")
+		}
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("StatusBadRequest 400 expected but was %v", w.Code)
+	}
+	if w.Body.String() != "Upload too large" {
+		t.Fatalf("Expected the configured message but was %s", w.Body.String())
+	}
+}
+
+// TestMaxBodySizeWithinLimit tests that a body within the limit can be read
+func TestMaxBodySizeWithinLimit(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/upload", strings.NewReader("small"))
+	w := httptest.NewRecorder()
+	handler := MaxBodySize(10)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil || string(body) != "small" {
+			t.Fatalf("Expected the body to be read but was %s, %v", body, err)
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusCreated {
+		t.Fatalf("StatusCreated 201 expected but was %v", w.Code)
+	}
+}
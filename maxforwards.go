@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+)
+
+// traceExcludedHeaders are the credential headers which aren't echoed in a TRACE response (RFC 7231 section 4.3.8)
+var traceExcludedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// MaxForwards middleware implements the Max-Forwards semantics for intermediaries (RFC 7231 section 5.1.2).
+// For TRACE & OPTIONS requests with a Max-Forwards header, a value of zero is responded to directly
+// rather than forwarded to the next handler, which for a proxy would forward the request upstream.
+// A TRACE is answered by echoing the received request, less its credential headers, as a message/http body, an OPTIONS with an empty StatusOK (200).
+// Positive values are decremented before the request is passed on. Other methods & unparsable values are ignored
+func MaxForwards() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodTrace && r.Method != http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			maxForwards, err := strconv.ParseUint(r.Header.Get("Max-Forwards"), 10, 32)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if maxForwards > 0 {
+				r.Header.Set("Max-Forwards", strconv.FormatUint(maxForwards-1, 10))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.Method == http.MethodOptions {
+				w.Header().Set("Content-Length", "0")
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+
+			// credentials are excluded from the echo so a TRACE can't be used to read them (cross-site tracing)
+			echo := r.Clone(r.Context())
+			for _, header := range traceExcludedHeaders {
+				echo.Header.Del(header)
+			}
+			dump, err := httputil.DumpRequest(echo, false)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "message/http")
+			w.WriteHeader(http.StatusOK)
+			w.Write(dump)
+		})
+	}
+}
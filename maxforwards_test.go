@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestMaxForwardsZeroTrace tests that a TRACE with Max-Forwards 0 is echoed directly rather than passed on
+func TestMaxForwardsZeroTrace(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("TRACE", "/resource", nil)
+	r.Header.Set("Max-Forwards", "0")
+	w := httptest.NewRecorder()
+	handler := MaxForwards()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "message/http" {
+		t.Fatalf("Expected Content-Type message/http but was %s", ct)
+	}
+	if body := w.Body.String(); !strings.HasPrefix(body, "TRACE /resource HTTP/1.1") {
+		t.Fatalf("Expected the request to be echoed but was %v", body)
+	}
+}
+
+// TestMaxForwardsTraceExcludesCredentials tests that credential headers aren't echoed in a TRACE response
+func TestMaxForwardsTraceExcludesCredentials(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("TRACE", "/resource", nil)
+	r.Header.Set("Max-Forwards", "0")
+	r.Header.Set("Authorization", "Bearer secret-token")
+	r.Header.Set("Proxy-Authorization", "Basic secret-proxy")
+	r.Header.Set("Cookie", "session=secret-session")
+	r.Header.Set("X-Custom", "visible")
+	w := httptest.NewRecorder()
+	handler := MaxForwards()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	body := w.Body.String()
+	if strings.Contains(body, "secret") {
+		t.Fatalf("Expected the credential headers to be excluded but was %v", body)
+	}
+	if !strings.Contains(body, "X-Custom: visible") {
+		t.Fatalf("Expected the other headers to be echoed but was %v", body)
+	}
+	if r.Header.Get("Authorization") == "" {
+		t.Fatal("Expected the original request's headers to be left unchanged")
+	}
+}
+
+// TestMaxForwardsZeroOptions tests that an OPTIONS with Max-Forwards 0 is responded to directly
+func TestMaxForwardsZeroOptions(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("OPTIONS", "/", nil)
+	r.Header.Set("Max-Forwards", "0")
+	w := httptest.NewRecorder()
+	handler := MaxForwards()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
+
+// TestMaxForwardsPositive tests that a positive Max-Forwards is decremented & the request passed on
+func TestMaxForwardsPositive(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("OPTIONS", "/", nil)
+	r.Header.Set("Max-Forwards", "3")
+	w := httptest.NewRecorder()
+	var forwarded string
+	handler := MaxForwards()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get("Max-Forwards")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("StatusNoContent 204 expected but was %v", w.Code)
+	}
+	if forwarded != "2" {
+		t.Fatalf("Expected Max-Forwards to be decremented to 2 but was %s", forwarded)
+	}
+}
@@ -1,11 +1,49 @@
 package middleware
 
-import "net/http"
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
 
 // Middleware is defined as a function which takes a http handler
 // and returns a new http handler which wraps the input with extra functionality
 type Middleware func(next http.Handler) http.Handler
 
+// Chain composes the middleware into a single middleware, applied in the order given.
+// The first middleware is the outermost, seeing the request first & the response last, so
+// Chain(A, B, C).Then(h) is equivalent to A(B(C(h)))
+func Chain(mw ...Middleware) Middleware {
+	return func(next http.Handler) http.Handler {
+		for i := len(mw) - 1; i >= 0; i-- {
+			next = mw[i](next)
+		}
+		return next
+	}
+}
+
+// Then wraps the handler with the middleware. It's a convenience for m(h) which reads in request order,
+// e.g. Chain(HTTPS, Auth(authFunc)).Then(handler)
+func (m Middleware) Then(h http.Handler) http.Handler {
+	return m(h)
+}
+
+// When applies the middleware only to requests matching the predicate, e.g. to skip Auth for /health.
+// Requests which don't match go straight to the next handler. The middleware wraps next once, up front,
+// so it isn't rebuilt on every request
+func When(pred func(*http.Request) bool, mw Middleware) Middleware {
+	return func(next http.Handler) http.Handler {
+		wrapped := mw(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if pred(r) {
+				wrapped.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // contextKey is a value for use with context.WithValue. It's used as
 // a pointer so it fits in an interface{} without allocation. This technique
 // for defining context keys was copied from Go 1.7's new use of context in net/http.
@@ -21,3 +59,32 @@ func (c *contextKey) String() string {
 func isHTTPStatusOk(status int) bool {
 	return status >= 200 && status < 300
 }
+
+// isJSON checks if the given headers declare a JSON content type
+func isJSON(header http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// containsString checks if the string is in the list
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold checks if the string is in the list, ignoring case, e.g. for HTTP methods & header names
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// appendHeader returns a middleware which appends its name to the X-Order header on the way in & out
+func appendHeader(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Order", name+" in")
+			next.ServeHTTP(w, r)
+			w.Header().Add("X-Order", name+" out")
+		})
+	}
+}
+
+// TestChainOrder tests that chained middleware is applied in order, the first being the outermost
+func TestChainOrder(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	w := httptest.NewRecorder()
+	handler := Chain(appendHeader("A"), appendHeader("B"), appendHeader("C")).Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Order", "handler")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	expected := []string{"A in", "B in", "C in", "handler", "C out", "B out", "A out"}
+	if order := w.Header()["X-Order"]; !reflect.DeepEqual(order, expected) {
+		t.Fatalf("Expected the middleware to be applied in the order %v but was %v", expected, order)
+	}
+}
+
+// TestChainEmpty tests that an empty chain returns the handler unwrapped
+func TestChainEmpty(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	w := httptest.NewRecorder()
+	handler := Chain().Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusTeapot {
+		t.Fatalf("StatusTeapot 418 expected but was %v", w.Code)
+	}
+}
+
+// TestWhen tests that the middleware is skipped when the predicate doesn't match & applied when it does
+func TestWhen(t *testing.T) {
+
+	// Arrange
+	authFunc := func(ctx context.Context, authorization string) (context.Context, error) {
+		if authorization != "Bearer valid" {
+			return ctx, errors.New("Invalid token")
+		}
+		return ctx, nil
+	}
+	notHealth := func(r *http.Request) bool { return r.URL.Path != "/health" }
+	handler := When(notHealth, Auth(authFunc))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(path, authorization string) int {
+		r, _ := http.NewRequest("GET", path, nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// Act
+	health := serve("/health", "")
+	unauthorized := serve("/users", "")
+	authorized := serve("/users", "Bearer valid")
+
+	// Assert
+	if health != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected for /health but was %v", health)
+	}
+	if unauthorized != http.StatusUnauthorized {
+		t.Fatalf("StatusUnauthorized 401 expected without credentials but was %v", unauthorized)
+	}
+	if authorized != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected with valid credentials but was %v", authorized)
+	}
+}
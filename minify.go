@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"regexp"
+)
+
+// Minifier minifies a response body of the given media type, e.g. text/html
+type Minifier interface {
+	Minify(mediaType string, body []byte) ([]byte, error)
+}
+
+// MinifierFunc is an adapter to allow the use of ordinary functions as Minifiers
+type MinifierFunc func(mediaType string, body []byte) ([]byte, error)
+
+// Minify calls f(mediaType, body)
+func (f MinifierFunc) Minify(mediaType string, body []byte) ([]byte, error) {
+	return f(mediaType, body)
+}
+
+// Minify middleware minifies buffered HTML, CSS & JS response bodies before they're written, reducing bandwidth for server rendered pages.
+// Responses whose Content-Type is one of types are minified, by default text/html, text/css, application/javascript & text/javascript.
+// The built in minifier only removes comments & whitespace, conservatively for JS, & leaves the contents of
+// <script>, <style>, <pre> & <textarea> elements untouched.
+// Use MinifyWith to plug in a full minifier
+func Minify(types ...string) Middleware {
+	return MinifyWith(MinifierFunc(basicMinify), types...)
+}
+
+// MinifyWith middleware is Minify using the supplied Minifier, e.g. an adapter to a third party minification library
+func MinifyWith(minifier Minifier, types ...string) Middleware {
+	if len(types) == 0 {
+		types = []string{"text/html", "text/css", "application/javascript", "text/javascript"}
+	}
+
+	return Transform(ResponseTransformerFunc(func(status int, header http.Header, body []byte) ([]byte, error) {
+		mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+		if err != nil || len(body) == 0 || !containsString(types, mediaType) {
+			return body, nil
+		}
+		return minifier.Minify(mediaType, body)
+	}))
+}
+
+var (
+	htmlCommentRegex      = regexp.MustCompile(`(?s)<!--.*?-->`)
+	whitespaceRegex       = regexp.MustCompile(`\s+`)
+	cssCommentRegex       = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	rawTextRegex          = regexp.MustCompile(`(?is)<script\b.*?</script\s*>|<style\b.*?</style\s*>|<pre\b.*?</pre\s*>|<textarea\b.*?</textarea\s*>`)
+	cssPunctuationRegex   = regexp.MustCompile(`\s*([{};,])\s*`)
+	cssSelectorRegex      = regexp.MustCompile(`([:>])\s+`)
+	jsLineWhitespaceRegex = regexp.MustCompile(`(?m)^[ \t]+|[ \t]+$`)
+	blankLinesRegex       = regexp.MustCompile(`\n{2,}`)
+)
+
+// basicMinify removes comments & whitespace from HTML & CSS. JS only has its indentation & blank lines removed,
+// as removing comments & joining lines safely needs a full JS parser
+func basicMinify(mediaType string, body []byte) ([]byte, error) {
+	switch mediaType {
+	case "text/html":
+		body = minifyHTML(body)
+	case "text/css":
+		body = cssCommentRegex.ReplaceAll(body, nil)
+		body = whitespaceRegex.ReplaceAll(body, []byte(" "))
+		body = cssPunctuationRegex.ReplaceAll(body, []byte("$1"))
+		// whitespace before : & > is significant in selectors, e.g. div :first-child, so it's only removed after them
+		body = cssSelectorRegex.ReplaceAll(body, []byte("$1"))
+	case "application/javascript", "text/javascript":
+		body = jsLineWhitespaceRegex.ReplaceAll(body, nil)
+		body = blankLinesRegex.ReplaceAll(body, []byte("\n"))
+	}
+	return bytes.TrimSpace(body), nil
+}
+
+// minifyHTML removes comments & whitespace from the HTML outside of <script>, <style>, <pre> & <textarea> elements,
+// whose contents are whitespace sensitive
+func minifyHTML(body []byte) []byte {
+	var minified []byte
+	start := 0
+	for _, raw := range rawTextRegex.FindAllIndex(body, -1) {
+		minified = append(minified, minifyMarkup(body[start:raw[0]])...)
+		minified = append(minified, body[raw[0]:raw[1]]...)
+		start = raw[1]
+	}
+	return append(minified, minifyMarkup(body[start:])...)
+}
+
+// minifyMarkup removes comments & collapses whitespace in HTML which doesn't contain any whitespace sensitive elements.
+// Whitespace between tags is collapsed to a single space rather than removed, as it renders between inline elements, e.g. <b>Hello</b> <i>World</i>
+func minifyMarkup(markup []byte) []byte {
+	markup = htmlCommentRegex.ReplaceAll(markup, nil)
+	return whitespaceRegex.ReplaceAll(markup, []byte(" "))
+}
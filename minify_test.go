@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestMinifyHTML tests that a HTML response has its comments & whitespace removed
+func TestMinifyHTML(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler := Minify()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("<html>\n  <!-- header -->\n  <body>\n    <p>Hello   world</p>\n  </body>\n</html>\n"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	if body := w.Body.String(); body != "<html> <body> <p>Hello world</p> </body> </html>" {
+		t.Fatalf("Expected minified HTML but was %v", body)
+	}
+}
+
+// TestMinifyHTMLInlineWhitespace tests that whitespace between inline elements is kept as a single space
+func TestMinifyHTMLInlineWhitespace(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler := Minify()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<p><b>Hello</b>   <i>World</i></p>"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if body := w.Body.String(); body != "<p><b>Hello</b> <i>World</i></p>" {
+		t.Fatalf("Expected the space between the inline elements to be kept but was %v", body)
+	}
+}
+
+// TestMinifyCSS tests that a CSS response has its comments & whitespace removed
+func TestMinifyCSS(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/site.css", nil)
+	w := httptest.NewRecorder()
+	handler := Minify()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css")
+		w.Write([]byte("/* layout */\nbody {\n  margin: 0;\n  padding: 0 1em;\n}\n"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if body := w.Body.String(); body != "body{margin:0;padding:0 1em;}" {
+		t.Fatalf("Expected minified CSS but was %v", body)
+	}
+}
+
+// TestMinifyHTMLRawText tests that the contents of whitespace sensitive elements aren't minified
+func TestMinifyHTMLRawText(t *testing.T) {
+
+	// Arrange
+	script := "<script>\nvar a = 1; // note\nalert(a);\n</script>"
+	pre := "<pre>a\n  b</pre>"
+	textarea := "<textarea>line 1\n\n  line 2</textarea>"
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler := Minify()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<body>\n  " + script + "\n  " + pre + "\n  " + textarea + "\n</body>"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if body := w.Body.String(); body != "<body> "+script+" "+pre+" "+textarea+" </body>" {
+		t.Fatalf("Expected the element contents to be untouched but was %v", body)
+	}
+}
+
+// TestMinifyCSSSelectors tests that significant whitespace in CSS selectors is kept
+func TestMinifyCSSSelectors(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/site.css", nil)
+	w := httptest.NewRecorder()
+	handler := Minify()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css")
+		w.Write([]byte("div :first-child {\n  color: red;\n}\nul > li {\n  margin: 0;\n}\n"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if body := w.Body.String(); body != "div :first-child{color:red;}ul >li{margin:0;}" {
+		t.Fatalf("Expected the selectors' whitespace to be kept but was %v", body)
+	}
+}
+
+// TestMinifyJSONUntouched tests that a JSON response isn't minified
+func TestMinifyJSONUntouched(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	json := "{\n  \"message\": \"Hello   world\"\n}\n"
+	handler := Minify()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(json))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if body := w.Body.String(); body != json {
+		t.Fatalf("Expected the JSON to be untouched but was %v", body)
+	}
+}
+
+// TestMinifyWithCustomMinifier tests that a plugged in Minifier is used for the configured types
+func TestMinifyWithCustomMinifier(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	upper := MinifierFunc(func(mediaType string, body []byte) ([]byte, error) {
+		return []byte(strings.ToUpper(string(body))), nil
+	})
+	handler := MinifyWith(upper, "text/plain")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("hello"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if body := w.Body.String(); body != "HELLO" {
+		t.Fatalf("Expected the custom minifier to be used but was %v", body)
+	}
+}
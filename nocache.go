@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// noCacheHeaders are the response headers which stop browsers & proxies caching the response
+var noCacheHeaders = map[string]string{
+	"Cache-Control": "no-store, must-revalidate",
+	"Pragma":        "no-cache",
+	"Expires":       "0",
+}
+
+// conditionalHeaders are the request headers which make a request conditional, so it could be answered with a StatusNotModified (304)
+var conditionalHeaders = []string{"If-Modified-Since", "If-None-Match"}
+
+// NoCache middleware stops browsers & proxies caching the response, for endpoints whose responses must always be fresh.
+// The request's conditional headers are removed, so middleware further down the chain, e.g. Etag, can't respond with a StatusNotModified (304)
+func NoCache() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, header := range conditionalHeaders {
+				r.Header.Del(header)
+			}
+			for header, value := range noCacheHeaders {
+				w.Header().Set(header, value)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestNoCache tests that the no cache headers are set & the conditional request headers removed
+func TestNoCache(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	r.Header.Set("If-None-Match", "W/\"4-DLxmEfVUC9CAmjiNyVphWw==\"")
+	r.Header.Set("If-Modified-Since", "Wed, 21 Oct 2015 07:28:00 GMT")
+	w := httptest.NewRecorder()
+	handler := Chain(NoCache(), DefaultEtag).Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+			t.Fatal("Expected the conditional request headers to be removed")
+		}
+		w.Write([]byte("Test"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	expected := map[string]string{
+		"Cache-Control": "no-store, must-revalidate",
+		"Pragma":        "no-cache",
+		"Expires":       "0",
+	}
+	for header, value := range expected {
+		if h := w.Header().Get(header); h != value {
+			t.Fatalf("Expected the %s header %s but was %s", header, value, h)
+		}
+	}
+}
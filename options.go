@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// MethodLister reports the http methods registered for a path.
+// It lets AutoOptions integrate with hand rolled routers
+type MethodLister interface {
+	Methods(path string) []string
+}
+
+// AutoOptions middleware responds to OPTIONS requests with an Allow header listing the methods
+// the router has registered for the requested path, without having to configure each path by hand.
+// OPTIONS requests for paths without any registered methods are passed on to the next handler.
+func AutoOptions(router MethodLister) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			methods := router.Methods(r.URL.Path)
+			if len(methods) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !containsFold(methods, http.MethodOptions) {
+				// the router's slice is copied, as appending could write into its backing array
+				methods = append(append(make([]string, 0, len(methods)+1), methods...), http.MethodOptions)
+			}
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeMethodLister lists the methods registered for each path
+type fakeMethodLister map[string][]string
+
+func (l fakeMethodLister) Methods(path string) []string {
+	return l[path]
+}
+
+// TestAutoOptionsAllowHeader tests that an OPTIONS request gets an Allow header with the registered methods
+func TestAutoOptionsAllowHeader(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("OPTIONS", "/items", nil)
+	w := httptest.NewRecorder()
+	router := fakeMethodLister{"/items": {"GET", "POST"}}
+	handler := AutoOptions(router)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("StatusNoContent 204 expected but was %v", w.Code)
+	}
+	if h := w.Header().Get("Allow"); h != "GET, POST, OPTIONS" {
+		t.Fatalf("Expected Allow header GET, POST, OPTIONS but was %s", h)
+	}
+}
+
+// TestAutoOptionsRouterSliceUnchanged tests that the router's methods aren't modified when OPTIONS is added
+func TestAutoOptionsRouterSliceUnchanged(t *testing.T) {
+
+	// Arrange
+	methods := make([]string, 2, 3)
+	copy(methods, []string{"GET", "POST"})
+	router := fakeMethodLister{"/items": methods, "/other": methods[:1]}
+	handler := AutoOptions(router)(http.NotFoundHandler())
+
+	// Act
+	for _, path := range []string{"/other", "/items"} {
+		r, _ := http.NewRequest("OPTIONS", path, nil)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	// Assert
+	if spare := methods[:3][2]; spare != "" {
+		t.Fatalf("Expected the router's backing array not to be written but was %s", spare)
+	}
+	if methods[1] != "POST" {
+		t.Fatalf("Expected the router's methods to be unchanged but were %v", methods)
+	}
+}
+
+// TestAutoOptionsUnknownPath tests that an OPTIONS request for a path without registered methods is passed on
+func TestAutoOptionsUnknownPath(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("OPTIONS", "/unknown", nil)
+	w := httptest.NewRecorder()
+	router := fakeMethodLister{"/items": {"GET", "POST"}}
+	handler := AutoOptions(router)(http.NotFoundHandler())
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("StatusNotFound 404 expected but was %v", w.Code)
+	}
+}
+
+// TestAutoOptionsOtherMethod tests that requests using other methods are passed on
+func TestAutoOptionsOtherMethod(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/items", nil)
+	w := httptest.NewRecorder()
+	router := fakeMethodLister{"/items": {"GET", "POST"}}
+	handler := AutoOptions(router)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	if h := w.Header().Get("Allow"); h != "" {
+		t.Fatalf("Expected no Allow header but was %s", h)
+	}
+}
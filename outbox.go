@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// Event is a message enqueued by a handler to be published once its transaction commits
+type Event struct {
+	Topic   string
+	Payload []byte
+}
+
+// Publisher publishes events to a message broker
+type Publisher interface {
+	Publish(ctx context.Context, events []Event) error
+}
+
+// OutboxOptions defines the user supplied Outbox configuration options.
+type OutboxOptions struct {
+	// Table is the name of the outbox table. It's interpolated into the SQL so must not come from user input. Default: outbox
+	Table string
+	// OnPublish is called once the events enqueued by a request have been published & deleted from the outbox,
+	// or with the error if publishing failed, e.g. for metrics. Default: failures are logged
+	OnPublish func(events []Event, err error)
+}
+
+// Outbox middleware implements the transactional outbox pattern.
+// Handlers enqueue events using EnqueueEvent, which writes them to the outbox table in the request's transaction,
+// so that an event is only recorded if the changes it describes are committed.
+// Once the transaction commits the events are published & their outbox rows deleted in the background, so a slow broker
+// doesn't delay the response. Publishing uses a background context, as the request's is cancelled once it's served.
+// Events which fail to publish are left in the outbox table for a relay to retry, giving at least once delivery.
+// Events enqueued by a request whose transaction rolls back are discarded. It must run after Transaction.
+//
+// The SQL is written for Postgres, or a compatible database such as CockroachDB, using $n placeholders & RETURNING.
+// The outbox table needs an id generated by the database, e.g.
+//
+//	CREATE TABLE outbox (
+//		id BIGSERIAL PRIMARY KEY,
+//		topic TEXT NOT NULL,
+//		payload BYTEA
+//	)
+func Outbox(db *sql.DB, publisher Publisher) Middleware {
+	return OutboxWithOptions(db, publisher, OutboxOptions{})
+}
+
+// OutboxWithOptions middleware is Outbox configured with the supplied OutboxOptions
+func OutboxWithOptions(db *sql.DB, publisher Publisher, opts OutboxOptions) Middleware {
+	if opts.Table == "" {
+		opts.Table = "outbox"
+	}
+	if opts.OnPublish == nil {
+		opts.OnPublish = logPublishError
+	}
+	insertQuery := "INSERT INTO " + opts.Table + " (topic, payload) VALUES ($1, $2) RETURNING id"
+	deleteQuery := "DELETE FROM " + opts.Table + " WHERE id = $1"
+
+	// publish publishes the events & deletes their outbox rows
+	publish := func(events []Event, ids []int64) {
+		ctx := context.Background()
+		if err := publisher.Publish(ctx, events); err != nil {
+			opts.OnPublish(events, err)
+			return
+		}
+		for _, id := range ids {
+			if _, err := db.ExecContext(ctx, deleteQuery, id); err != nil {
+				log.Printf("middleware: deleting published outbox event %d failed: %v", id, err)
+			}
+		}
+		opts.OnPublish(events, nil)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			outbox := &outbox{insertQuery: insertQuery}
+
+			committed := func() {
+				events, ids := outbox.pending()
+				if len(events) == 0 {
+					return
+				}
+				go publish(events, ids)
+			}
+
+			if !OnCommit(ctx, committed) {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			ctx = context.WithValue(ctx, outboxKey, outbox)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// logPublishError logs the events which failed to publish
+func logPublishError(events []Event, err error) {
+	if err != nil {
+		log.Printf("middleware: publishing %d outbox events failed: %v", len(events), err)
+	}
+}
+
+// outbox context key
+var outboxKey = &contextKey{"Outbox"}
+
+// outbox is the request scoped list of events written to the outbox table
+type outbox struct {
+	mu          sync.Mutex
+	insertQuery string
+	events      []Event
+	ids         []int64
+}
+
+// pending gets the enqueued events & their outbox row ids
+func (o *outbox) pending() ([]Event, []int64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.events, o.ids
+}
+
+// EnqueueEvent writes the event to the outbox table using the request's transaction.
+// It's published once the transaction commits. An error is returned if Outbox isn't in use, & ErrNoTransaction if Transaction isn't
+func EnqueueEvent(ctx context.Context, event Event) error {
+	o, ok := ctx.Value(outboxKey).(*outbox)
+	if !ok {
+		return errors.New("Outbox middleware isn't in use")
+	}
+	tx, ok := GetTransactionOk(ctx)
+	if !ok {
+		return ErrNoTransaction
+	}
+
+	var id int64
+	err := tx.QueryRowContext(ctx, o.insertQuery, event.Topic, event.Payload).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, event)
+	o.ids = append(o.ids, id)
+	return nil
+}
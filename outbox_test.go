@@ -0,0 +1,199 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// fakePublisher records the events published to it, waiting for release, if set, before publishing
+type fakePublisher struct {
+	mu        sync.Mutex
+	published []Event
+	release   chan struct{}
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, events []Event) error {
+	if p.release != nil {
+		<-p.release
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.published = append(p.published, events...)
+	return nil
+}
+
+func (p *fakePublisher) events() []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.published
+}
+
+// notifyPublished returns an OnPublish func which sends the publish result to the channel
+func notifyPublished(published chan error) func([]Event, error) {
+	return func(events []Event, err error) {
+		published <- err
+	}
+}
+
+// TestOutboxPublishOnCommit tests that enqueued events are published, & deleted from the outbox, once the transaction commits
+func TestOutboxPublishOnCommit(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/orders", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO outbox").WithArgs("order.created", []byte(`{"id":1}`)).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectCommit()
+	mock.ExpectExec("DELETE FROM outbox").WithArgs(int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	publisher := &fakePublisher{}
+	published := make(chan error, 1)
+	handler := Transaction(db)(OutboxWithOptions(db, publisher, OutboxOptions{OnPublish: notifyPublished(published)})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := EnqueueEvent(r.Context(), Event{Topic: "order.created", Payload: []byte(`{"id":1}`)}); err != nil {
+			t.Fatal(err)
+		}
+		if len(publisher.events()) != 0 {
+			t.Fatal("Expected the event not to be published before the transaction commits")
+		}
+		w.WriteHeader(http.StatusCreated)
+	})))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusCreated {
+		t.Fatalf("StatusCreated 201 expected but was %v", w.Code)
+	}
+	if err := <-published; err != nil {
+		t.Fatalf("Expected the events to be published but got %v", err)
+	}
+	if events := publisher.events(); len(events) != 1 || events[0].Topic != "order.created" {
+		t.Fatalf("Expected the order.created event to be published but was %+v", events)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unmet sql expectations: %v", err)
+	}
+}
+
+// TestOutboxDiscardOnRollback tests that enqueued events aren't published when the transaction rolls back
+func TestOutboxDiscardOnRollback(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/orders", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO outbox").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectRollback()
+
+	publisher := &fakePublisher{}
+	handler := Transaction(db)(Outbox(db, publisher)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := EnqueueEvent(r.Context(), Event{Topic: "order.created"}); err != nil {
+			t.Fatal(err)
+		}
+		w.WriteHeader(http.StatusConflict)
+	})))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusConflict {
+		t.Fatalf("StatusConflict 409 expected but was %v", w.Code)
+	}
+	if events := publisher.events(); len(events) != 0 {
+		t.Fatalf("Expected no events to be published but was %+v", events)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unmet sql expectations: %v", err)
+	}
+}
+
+// TestOutboxPublishAsync tests that the response is written without waiting for a slow broker, & that the configured table is used
+func TestOutboxPublishAsync(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/orders", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO order_events").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectCommit()
+	mock.ExpectExec("DELETE FROM order_events").WithArgs(int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	publisher := &fakePublisher{release: make(chan struct{})}
+	published := make(chan error, 1)
+	options := OutboxOptions{Table: "order_events", OnPublish: notifyPublished(published)}
+	handler := Transaction(db)(OutboxWithOptions(db, publisher, options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := EnqueueEvent(r.Context(), Event{Topic: "order.created"}); err != nil {
+			t.Fatal(err)
+		}
+		w.WriteHeader(http.StatusCreated)
+	})))
+
+	// Act
+	handler.ServeHTTP(w, r)
+	code := w.Code
+	close(publisher.release)
+
+	// Assert
+	if code != http.StatusCreated {
+		t.Fatalf("StatusCreated 201 expected before the event is published but was %v", code)
+	}
+	if err := <-published; err != nil {
+		t.Fatalf("Expected the events to be published but got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unmet sql expectations: %v", err)
+	}
+}
+
+// TestOutboxNoTransaction tests that a 500 is returned when Outbox isn't run after Transaction
+func TestOutboxNoTransaction(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/orders", nil)
+	w := httptest.NewRecorder()
+
+	db, _, _ := sqlmock.New()
+	defer db.Close()
+	handler := Outbox(db, &fakePublisher{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("StatusInternalServerError 500 expected but was %v", w.Code)
+	}
+}
+
+// TestEnqueueEventNoTransaction tests that ErrNoTransaction is returned when there's no transaction in the context
+func TestEnqueueEventNoTransaction(t *testing.T) {
+
+	// Arrange
+	ctx := context.WithValue(context.Background(), outboxKey, &outbox{})
+
+	// Act
+	err := EnqueueEvent(ctx, Event{Topic: "orders", Payload: []byte(`{}`)})
+
+	// Assert
+	if err != ErrNoTransaction {
+		t.Fatalf("Expected ErrNoTransaction but was %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+// PerConnLimit middleware limits the number of requests served on a single keep-alive connection,
+// so that one persistent connection can't hog the server's resources.
+// The request which reaches max is served with a Connection: close header, asking the client to reconnect.
+// Any further requests on the connection are rejected with a StatusTooManyRequests (429).
+// The requests are counted per connection using a value added to the connection's context by ConnContext,
+// which must be set as the http.Server's ConnContext hook, e.g.
+//
+//	server := &http.Server{Handler: PerConnLimit(100)(handler), ConnContext: ConnContext}
+//
+// Requests are passed on uncounted if the hook isn't set
+func PerConnLimit(max int) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			counter, ok := r.Context().Value(connRequestsKey).(*int64)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			requests := atomic.AddInt64(counter, 1)
+			if requests > int64(max) {
+				w.Header().Set("Connection", "close")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			if requests == int64(max) {
+				w.Header().Set("Connection", "close")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// conn requests context key
+var connRequestsKey = &contextKey{"ConnRequests"}
+
+// ConnContext adds a request counter to the connection's context. Set it as the http.Server's ConnContext hook when using PerConnLimit
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connRequestsKey, new(int64))
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestPerConnLimitManyRequests tests that requests on one connection are served up to the limit, the last asking the client to reconnect, & rejected after it
+func TestPerConnLimitManyRequests(t *testing.T) {
+
+	// Arrange
+	connCtx := ConnContext(context.Background(), nil)
+	handler := PerConnLimit(3)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	expected := []struct {
+		status     int
+		connection string
+	}{
+		{http.StatusOK, ""},
+		{http.StatusOK, ""},
+		{http.StatusOK, "close"},
+		{http.StatusTooManyRequests, "close"},
+	}
+
+	for i, e := range expected {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r = r.WithContext(connCtx)
+		w := httptest.NewRecorder()
+
+		// Act
+		handler.ServeHTTP(w, r)
+
+		// Assert
+		if w.Code != e.status {
+			t.Fatalf("Status %v expected for request %v but was %v", e.status, i+1, w.Code)
+		}
+		if c := w.Header().Get("Connection"); c != e.connection {
+			t.Fatalf("Expected Connection header %q for request %v but was %q", e.connection, i+1, c)
+		}
+	}
+}
+
+// TestPerConnLimitSeparateConnections tests that each connection has its own count
+func TestPerConnLimitSeparateConnections(t *testing.T) {
+
+	// Arrange
+	handler := PerConnLimit(1)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for i := 0; i < 2; i++ {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r = r.WithContext(ConnContext(context.Background(), nil))
+		w := httptest.NewRecorder()
+
+		// Act
+		handler.ServeHTTP(w, r)
+
+		// Assert
+		if w.Code != http.StatusOK {
+			t.Fatalf("StatusOK 200 expected for connection %v but was %v", i+1, w.Code)
+		}
+	}
+}
+
+// TestPerConnLimitEndToEnd tests the limit using a real server, whose keep-alive connection is reused by the client
+func TestPerConnLimitEndToEnd(t *testing.T) {
+
+	// Arrange
+	server := httptest.NewUnstartedServer(PerConnLimit(2)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	server.Config.ConnContext = ConnContext
+	server.Start()
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+
+		// Act
+		resp, err := server.Client().Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		// Assert
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("StatusOK 200 expected but was %v", resp.StatusCode)
+		}
+		if i == 1 && !resp.Close {
+			t.Fatal("Expected the connection to be closed once the limit was reached")
+		}
+	}
+}
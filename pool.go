@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"database/sql"
+	"net/http"
+)
+
+// PoolAware middleware sheds requests with a StatusServiceUnavailable (503) when the database connection pool is near saturation,
+// rather than letting them queue up on BeginTx in the Transaction middleware under load.
+// The pool is saturated once the connections in use reach threshold (0 to 1) of the pool's max open connections.
+// Pools without a max open connection limit are never considered saturated.
+func PoolAware(db *sql.DB, threshold float64) Middleware {
+	return poolAware(db.Stats, threshold)
+}
+
+// poolAware creates the PoolAware middleware using the supplied source of connection pool stats
+func poolAware(stats func() sql.DBStats, threshold float64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s := stats()
+			if s.MaxOpenConnections > 0 && float64(s.InUse) >= threshold*float64(s.MaxOpenConnections) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
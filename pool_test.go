@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// stubStats returns a stats source reporting the given pool usage
+func stubStats(inUse int, maxOpen int) func() sql.DBStats {
+	return func() sql.DBStats {
+		return sql.DBStats{InUse: inUse, MaxOpenConnections: maxOpen}
+	}
+}
+
+// TestPoolAwareSaturated tests that StatusServiceUnavailable is returned when the pool is saturated
+func TestPoolAwareSaturated(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler := poolAware(stubStats(9, 10), 0.9)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("StatusServiceUnavailable 503 expected but was %v", w.Code)
+	}
+}
+
+// TestPoolAwareHealthy tests that requests pass through when the pool has capacity
+func TestPoolAwareHealthy(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler := poolAware(stubStats(2, 10), 0.9)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
+
+// TestPoolAwareUnlimitedPool tests that a pool without a max open connection limit is never saturated
+func TestPoolAwareUnlimitedPool(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	db, _, _ := sqlmock.New()
+	defer db.Close()
+	handler := PoolAware(db, 0.9)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// QueryLogEntry records a SQL statement issued during a request & how long it took
+type QueryLogEntry struct {
+	Query    string
+	Duration time.Duration
+}
+
+// QueryLog middleware enables per request SQL profiling.
+// Statements issued with TxExec, TxQuery & TxQueryRow are recorded, along with their duration,
+// and can be read using GetQueryLog, e.g. to write them to a debug header or log
+func QueryLog() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), queryLogKey, &queryLog{})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// query log context key
+var queryLogKey = &contextKey{"QueryLog"}
+
+// queryLog is the request scoped log of SQL statements
+type queryLog struct {
+	mu      sync.Mutex
+	entries []QueryLogEntry
+}
+
+// GetQueryLog gets the SQL statements recorded during the request, or nil if QueryLog isn't in use
+func GetQueryLog(ctx context.Context) []QueryLogEntry {
+	log, ok := ctx.Value(queryLogKey).(*queryLog)
+	if !ok {
+		return nil
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	entries := make([]QueryLogEntry, len(log.entries))
+	copy(entries, log.entries)
+	return entries
+}
+
+// recordQuery adds the statement to the request's query log, if there is one
+func recordQuery(ctx context.Context, query string, start time.Time) {
+	log, ok := ctx.Value(queryLogKey).(*queryLog)
+	if !ok {
+		return
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	log.entries = append(log.entries, QueryLogEntry{Query: query, Duration: time.Since(start)})
+}
+
+// ErrNoTransaction is returned by TxExec, TxQuery & TxQueryRow when the Transaction middleware hasn't stored a transaction in the context
+var ErrNoTransaction = errors.New("No transaction in the request context, is the Transaction middleware in use?")
+
+// TxExec executes a statement using the request's transaction, recording it in the query log
+func TxExec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	tx, ok := GetTransactionOk(ctx)
+	if !ok {
+		return nil, ErrNoTransaction
+	}
+	defer recordQuery(ctx, query, time.Now())
+	return tx.ExecContext(ctx, query, args...)
+}
+
+// TxQuery executes a query using the request's transaction, recording it in the query log
+func TxQuery(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	tx, ok := GetTransactionOk(ctx)
+	if !ok {
+		return nil, ErrNoTransaction
+	}
+	defer recordQuery(ctx, query, time.Now())
+	return tx.QueryContext(ctx, query, args...)
+}
+
+// Row is the result of TxQueryRow, satisfied by *sql.Row
+type Row interface {
+	Scan(dest ...interface{}) error
+	Err() error
+}
+
+// TxQueryRow executes a query, that's expected to return at most one row, using the request's transaction, recording it in the query log.
+// Like *sql.Row any error, including ErrNoTransaction, is deferred until Scan is called
+func TxQueryRow(ctx context.Context, query string, args ...interface{}) Row {
+	tx, ok := GetTransactionOk(ctx)
+	if !ok {
+		return errRow{ErrNoTransaction}
+	}
+	defer recordQuery(ctx, query, time.Now())
+	return tx.QueryRowContext(ctx, query, args...)
+}
+
+// errRow is a Row which failed before the query was executed
+type errRow struct {
+	err error
+}
+
+// Scan returns the row's error
+func (r errRow) Scan(dest ...interface{}) error {
+	return r.err
+}
+
+// Err returns the row's error
+func (r errRow) Err() error {
+	return r.err
+}
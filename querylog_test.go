@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// TestQueryLogRecordsQueries tests that the statements issued during a request are recorded with their durations
+func TestQueryLogRecordsQueries(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT name FROM users").WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("test")).WillDelayFor(time.Millisecond)
+	mock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var entries []QueryLogEntry
+	handler := QueryLog()(Transaction(db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var name string
+		if err := TxQueryRow(r.Context(), "SELECT name FROM users WHERE id = ?", 1).Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := TxExec(r.Context(), "UPDATE users SET name = ? WHERE id = ?", name, 1); err != nil {
+			t.Fatal(err)
+		}
+		entries = GetQueryLog(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 query log entries but got %v", len(entries))
+	}
+	if entries[0].Query != "SELECT name FROM users WHERE id = ?" {
+		t.Fatalf("Expected the SELECT to be logged first but was %s", entries[0].Query)
+	}
+	if entries[0].Duration < time.Millisecond {
+		t.Fatalf("Expected the SELECT duration to be at least 1ms but was %v", entries[0].Duration)
+	}
+	if entries[1].Query != "UPDATE users SET name = ? WHERE id = ?" {
+		t.Fatalf("Expected the UPDATE to be logged second but was %s", entries[1].Query)
+	}
+}
+
+// TestGetQueryLogNotEnabled tests that GetQueryLog returns nil when QueryLog isn't in use
+func TestGetQueryLogNotEnabled(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+
+	// Act
+	entries := GetQueryLog(r.Context())
+
+	// Assert
+	if entries != nil {
+		t.Fatalf("Expected no query log but got %v", entries)
+	}
+}
+
+// TestTxNoTransaction tests that ErrNoTransaction is returned, rather than panicking, when the Transaction middleware isn't in use
+func TestTxNoTransaction(t *testing.T) {
+
+	// Arrange
+	ctx := context.Background()
+	var name string
+
+	// Act
+	_, execErr := TxExec(ctx, "UPDATE users SET name = ?", "a")
+	_, queryErr := TxQuery(ctx, "SELECT name FROM users")
+	scanErr := TxQueryRow(ctx, "SELECT name FROM users WHERE id = ?", 1).Scan(&name)
+
+	// Assert
+	for _, err := range []error{execErr, queryErr, scanErr} {
+		if err != ErrNoTransaction {
+			t.Fatalf("Expected ErrNoTransaction but was %v", err)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// QueryTimeout middleware sets the timeout for individual database queries made during the request.
+// Handlers derive a timeout bounded context for each query using QueryContext, so one slow query
+// can't use up the whole request's time while the request's transaction stays open.
+func QueryTimeout(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), queryTimeoutKey, d)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// query timeout context key
+var queryTimeoutKey = &contextKey{"QueryTimeout"}
+
+// QueryContext creates a child context for a single query, bounded by the timeout set by QueryTimeout.
+// If QueryTimeout isn't in use the child context only has a cancel func.
+// The returned cancel func should be called once the query has completed
+func QueryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d, ok := ctx.Value(queryTimeoutKey).(time.Duration); ok {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
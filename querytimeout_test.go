@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestQueryTimeoutDeadline tests that a context derived using QueryContext carries the expected deadline
+func TestQueryTimeoutDeadline(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	var before, after, deadline time.Time
+	var hasDeadline bool
+	handler := QueryTimeout(2 * time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		before = time.Now()
+		ctx, cancel := QueryContext(r.Context())
+		defer cancel()
+		after = time.Now()
+		deadline, hasDeadline = ctx.Deadline()
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if !hasDeadline {
+		t.Fatal("Expected the query context to have a deadline")
+	}
+	if deadline.Before(before.Add(2*time.Second)) || deadline.After(after.Add(2*time.Second)) {
+		t.Fatalf("Expected the deadline to be 2s after the query context was created but was %v", deadline.Sub(before))
+	}
+}
+
+// TestQueryContextNoTimeout tests that a context derived using QueryContext has no deadline when QueryTimeout isn't in use
+func TestQueryContextNoTimeout(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+
+	// Act
+	ctx, cancel := QueryContext(r.Context())
+	defer cancel()
+
+	// Assert
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatal("Expected the query context to have no deadline")
+	}
+}
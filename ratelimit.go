@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"container/list"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit middleware limits each client to rps requests per second, with bursts of up to burst requests,
+// using an in memory token bucket per key. keyFunc identifies the client, e.g. by API key. A nil keyFunc keys on the
+// client's IP address, which should be used with RealIP when behind a proxy. Requests over the limit get a
+// StatusTooManyRequests (429) with a Retry-After header. Idle buckets are evicted, & at most 100,000 clients are tracked,
+// to bound memory
+func RateLimit(rps float64, burst int, keyFunc func(*http.Request) string) Middleware {
+	if rps <= 0 || burst < 1 {
+		panic("RateLimit requires a positive rps & burst")
+	}
+	if keyFunc == nil {
+		keyFunc = clientIP
+	}
+	limiter := newRateLimiter(rps, burst, rateLimitMaxKeys, time.Now)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ok, retryAfter := limiter.allow(keyFunc(r)); !ok {
+				seconds := int64(math.Ceil(retryAfter.Seconds()))
+				if seconds < 1 {
+					seconds = 1
+				}
+				w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP keys requests on the client's IP address, falling back to the whole RemoteAddr if it can't be parsed
+func clientIP(r *http.Request) string {
+	if ip := remoteIP(r); ip != nil {
+		return ip.String()
+	}
+	return r.RemoteAddr
+}
+
+// rateLimitMaxKeys is the most clients whose buckets are held in memory. When it's reached the least recently seen
+// client's bucket is evicted, which gives that client a full bucket on its next request
+const rateLimitMaxKeys = 100000
+
+// tokenBucket holds the tokens available to a client, as of the last time it was refilled
+type tokenBucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is a set of token buckets, one per key, ordered from the most to the least recently seen.
+// It's implemented in house, rather than with golang.org/x/time/rate, so the package doesn't take on another dependency.
+// Keeping the buckets in order means idle buckets are evicted from the back as requests arrive, without scanning the map
+type rateLimiter struct {
+	mu      sync.Mutex
+	rps     float64
+	burst   float64
+	maxKeys int
+	buckets map[string]*list.Element
+	order   *list.List
+	now     func() time.Time
+	idle    time.Duration // how long until an unused bucket is full, & so can be evicted
+}
+
+// newRateLimiter creates a rateLimiter which refills buckets at rps up to burst tokens, holding at most maxKeys buckets
+func newRateLimiter(rps float64, burst int, maxKeys int, now func() time.Time) *rateLimiter {
+	return &rateLimiter{
+		rps:     rps,
+		burst:   float64(burst),
+		maxKeys: maxKeys,
+		buckets: make(map[string]*list.Element),
+		order:   list.New(),
+		now:     now,
+		idle:    time.Duration(float64(burst) / rps * float64(time.Second)),
+	}
+}
+
+// allow takes a token from the key's bucket. If the bucket is empty it returns false & how long until a token is available
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.evictIdle(now)
+
+	var bucket *tokenBucket
+	if element, ok := l.buckets[key]; ok {
+		l.order.MoveToFront(element)
+		bucket = element.Value.(*tokenBucket)
+	} else {
+		if l.order.Len() >= l.maxKeys {
+			l.remove(l.order.Back())
+		}
+		bucket = &tokenBucket{key: key, tokens: l.burst, last: now}
+		l.buckets[key] = l.order.PushFront(bucket)
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rps)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / l.rps * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// evictIdle evicts the least recently seen buckets which have refilled while idle, as they're no different to a new bucket
+func (l *rateLimiter) evictIdle(now time.Time) {
+	for back := l.order.Back(); back != nil && now.Sub(back.Value.(*tokenBucket).last) >= l.idle; back = l.order.Back() {
+		l.remove(back)
+	}
+}
+
+// remove evicts the bucket
+func (l *rateLimiter) remove(element *list.Element) {
+	l.order.Remove(element)
+	delete(l.buckets, element.Value.(*tokenBucket).key)
+}
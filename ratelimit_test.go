@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestRateLimitWithinLimit tests that requests within the burst reach the next handler
+func TestRateLimitWithinLimit(t *testing.T) {
+
+	// Arrange
+	handler := RateLimit(1, 3, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for i := 0; i < 3; i++ {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.RemoteAddr = "203.0.113.7:41234"
+		w := httptest.NewRecorder()
+
+		// Act
+		handler.ServeHTTP(w, r)
+
+		// Assert
+		if w.Code != http.StatusOK {
+			t.Fatalf("StatusOK 200 expected for request %v but was %v", i+1, w.Code)
+		}
+	}
+}
+
+// TestRateLimitOverLimit tests that a request over the limit gets a StatusTooManyRequests (429) with a Retry-After header,
+// while other clients are unaffected
+func TestRateLimitOverLimit(t *testing.T) {
+
+	// Arrange
+	handler := RateLimit(0.5, 1, func(r *http.Request) string { return r.Header.Get("X-API-Key") })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(key string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// Act
+	serve("client-1")
+	limited := serve("client-1")
+	other := serve("client-2")
+
+	// Assert
+	if limited.Code != http.StatusTooManyRequests {
+		t.Fatalf("StatusTooManyRequests 429 expected but was %v", limited.Code)
+	}
+	if h := limited.Header().Get("Retry-After"); h != "2" {
+		t.Fatalf("Expected the Retry-After header 2 but was %s", h)
+	}
+	if other.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected for another client but was %v", other.Code)
+	}
+}
+
+// TestRateLimiterRefillAndEvict tests that buckets refill over time & idle buckets are evicted
+func TestRateLimiterRefillAndEvict(t *testing.T) {
+
+	// Arrange
+	now := time.Now()
+	limiter := newRateLimiter(1, 1, 10, func() time.Time { return now })
+
+	// Act & Assert
+	if ok, _ := limiter.allow("client-1"); !ok {
+		t.Fatal("Expected the first request to be allowed")
+	}
+	if ok, retryAfter := limiter.allow("client-1"); ok || retryAfter != time.Second {
+		t.Fatalf("Expected the second request to wait 1s but was allowed %v, %v", ok, retryAfter)
+	}
+	now = now.Add(time.Second)
+	if ok, _ := limiter.allow("client-1"); !ok {
+		t.Fatal("Expected the bucket to refill after 1s")
+	}
+	now = now.Add(2 * time.Second)
+	limiter.allow("client-2")
+	if _, ok := limiter.buckets["client-1"]; ok {
+		t.Fatal("Expected the idle bucket to be evicted")
+	}
+}
+
+// TestRateLimiterMaxKeys tests that the least recently seen bucket is evicted once the limit on keys is reached
+func TestRateLimiterMaxKeys(t *testing.T) {
+
+	// Arrange
+	now := time.Now()
+	limiter := newRateLimiter(1, 1, 2, func() time.Time { return now })
+
+	// Act
+	limiter.allow("client-1")
+	limiter.allow("client-2")
+	limiter.allow("client-1")
+	limiter.allow("client-3")
+
+	// Assert
+	if len(limiter.buckets) != 2 || limiter.order.Len() != 2 {
+		t.Fatalf("Expected 2 buckets but there were %v", len(limiter.buckets))
+	}
+	if _, ok := limiter.buckets["client-2"]; ok {
+		t.Fatal("Expected the least recently seen bucket to be evicted")
+	}
+	if ok, _ := limiter.allow("client-1"); ok {
+		t.Fatal("Expected the recently seen bucket to be kept")
+	}
+}
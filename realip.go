@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RealIPOptions defines the user supplied RealIP configuration options.
+type RealIPOptions struct {
+	// TrustedProxies are the CIDRs, e.g. 10.0.0.0/8, of the proxies allowed to set X-Forwarded-For & X-Real-IP.
+	// The headers are ignored on requests from any other address, as a client connecting directly could spoof them.
+	// X-Forwarded-For is walked from the right, skipping the trusted proxies, & the first untrusted address is used,
+	// as every entry to the left of it could have been set by the client.
+	// Default: empty, the immediate peer is trusted whatever its address & only the last X-Forwarded-For entry, the one
+	// it appended, is used. This is only safe when every request comes through a single proxy
+	TrustedProxies []string
+}
+
+// RealIP middleware sets the request's RemoteAddr to the client's IP address when behind a load balancer or proxy,
+// so that rate limiting & logging further down the chain see the client rather than the proxy.
+// The last address in X-Forwarded-For, i.e. the one the proxy appended, is used, or X-Real-IP if it isn't set.
+// Use RealIPWithOptions with TrustedProxies when there's more than one proxy, or requests can bypass it
+func RealIP() Middleware {
+	return RealIPWithOptions(RealIPOptions{})
+}
+
+// RealIPWithOptions middleware sets the request's RemoteAddr to the client's IP address, like RealIP, using the user supplied options.
+// It panics if a trusted proxy CIDR is invalid
+func RealIPWithOptions(opts RealIPOptions) Middleware {
+	trusted := parseCIDRs(opts.TrustedProxies)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(trusted) == 0 || containsIP(trusted, remoteIP(r)) {
+				if ip := forwardedIP(r, trusted); ip != nil {
+					r.RemoteAddr = ip.String()
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedIP gets the client's IP address from the X-Forwarded-For or X-Real-IP header, or nil if neither holds a valid one.
+// X-Forwarded-For is walked from the right & the first address which isn't a trusted proxy is used. Each proxy appends
+// the address it received the request from, so only the entries added by the trusted proxies can be relied upon
+func forwardedIP(r *http.Request, trusted []*net.IPNet) net.IP {
+	if forwardedFor := r.Header.Values("X-Forwarded-For"); len(forwardedFor) > 0 {
+		hops := strings.Split(strings.Join(forwardedFor, ","), ",")
+		var ip net.IP
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip = net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil || !containsIP(trusted, ip) {
+				return ip
+			}
+		}
+		// every hop is a trusted proxy, so the leftmost is the closest to the client
+		return ip
+	}
+	return net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP")))
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// serveRealIP serves the request using the RealIP middleware & returns the RemoteAddr the handler saw
+func serveRealIP(middleware Middleware, r *http.Request) string {
+	var remoteAddr string
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteAddr = r.RemoteAddr
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	return remoteAddr
+}
+
+// TestRealIPForwardedFor tests that the address appended by the proxy, the last of the X-Forwarded-For hops, is used
+func TestRealIPForwardedFor(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.2:41234"
+	r.Header.Set("X-Forwarded-For", "192.0.2.1, 203.0.113.7")
+
+	// Act
+	remoteAddr := serveRealIP(RealIP(), r)
+
+	// Assert
+	if remoteAddr != "203.0.113.7" {
+		t.Fatalf("Expected the RemoteAddr 203.0.113.7 but was %s", remoteAddr)
+	}
+}
+
+// TestRealIPForwardedForProxies tests that the trusted proxies are skipped in X-Forwarded-For & the first untrusted
+// address from the right is used, so the addresses injected by the client are ignored
+func TestRealIPForwardedForProxies(t *testing.T) {
+
+	tests := []struct {
+		forwardedFor []string
+		expected     string
+	}{
+		{[]string{"203.0.113.7, 10.0.0.1"}, "203.0.113.7"},
+		{[]string{"192.0.2.1, 203.0.113.7, 10.0.0.3, 10.0.0.1"}, "203.0.113.7"},
+		{[]string{"192.0.2.1", "203.0.113.7, 10.0.0.1"}, "203.0.113.7"},
+		{[]string{"10.0.0.3, 10.0.0.1"}, "10.0.0.3"},
+	}
+
+	for _, test := range tests {
+
+		// Arrange
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.RemoteAddr = "10.0.0.2:41234"
+		for _, forwardedFor := range test.forwardedFor {
+			r.Header.Add("X-Forwarded-For", forwardedFor)
+		}
+
+		// Act
+		remoteAddr := serveRealIP(RealIPWithOptions(RealIPOptions{TrustedProxies: []string{"10.0.0.0/8"}}), r)
+
+		// Assert
+		if remoteAddr != test.expected {
+			t.Fatalf("Expected the RemoteAddr %s from %v but was %s", test.expected, test.forwardedFor, remoteAddr)
+		}
+	}
+}
+
+// TestRealIPRealIPHeader tests that X-Real-IP is used when X-Forwarded-For isn't set
+func TestRealIPRealIPHeader(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.2:41234"
+	r.Header.Set("X-Real-IP", "2001:db8::1")
+
+	// Act
+	remoteAddr := serveRealIP(RealIP(), r)
+
+	// Assert
+	if remoteAddr != "2001:db8::1" {
+		t.Fatalf("Expected the RemoteAddr 2001:db8::1 but was %s", remoteAddr)
+	}
+}
+
+// TestRealIPTrustedProxies tests that the headers are only honoured from the trusted proxies
+func TestRealIPTrustedProxies(t *testing.T) {
+
+	tests := []struct {
+		remoteAddr string
+		expected   string
+	}{
+		{"10.0.0.2:41234", "203.0.113.7"},
+		{"198.51.100.17:41234", "198.51.100.17:41234"},
+	}
+
+	for _, test := range tests {
+
+		// Arrange
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		r.Header.Set("X-Forwarded-For", "203.0.113.7")
+
+		// Act
+		remoteAddr := serveRealIP(RealIPWithOptions(RealIPOptions{TrustedProxies: []string{"10.0.0.0/8"}}), r)
+
+		// Assert
+		if remoteAddr != test.expected {
+			t.Fatalf("Expected the RemoteAddr %s from %s but was %s", test.expected, test.remoteAddr, remoteAddr)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"runtime/debug"
+)
+
+// PanicFunc handles a panic recovered by Recover. It's given the recovered value & the stack trace of the panic
+// and is responsible for writing the response
+type PanicFunc func(w http.ResponseWriter, r *http.Request, recovered interface{}, stack []byte)
+
+// Recover middleware recovers from panics in the next handler, so a single request can't bring down the server.
+// The onPanic hook is called with the recovered value & stack, e.g. to log them, or if nil a StatusInternalServerError (500) is written.
+// http.ErrAbortHandler is re-panicked, as it's used to deliberately abort the response.
+// It's safe to use as the outermost middleware of a Chain, catching panics from all the middleware within
+func Recover(onPanic PanicFunc) Middleware {
+	if onPanic == nil {
+		onPanic = internalServerError
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+				onPanic(w, r, rec, debug.Stack())
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// internalServerError is the default PanicFunc, writing a StatusInternalServerError (500)
+func internalServerError(w http.ResponseWriter, r *http.Request, recovered interface{}, stack []byte) {
+	w.WriteHeader(http.StatusInternalServerError)
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestRecoverDefault tests that a panic is recovered & a StatusInternalServerError (500) written
+func TestRecoverDefault(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	w := httptest.NewRecorder()
+	handler := Recover(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("StatusInternalServerError 500 expected but was %v", w.Code)
+	}
+}
+
+// TestRecoverHook tests that the hook is given the recovered value & the stack trace of the panic
+func TestRecoverHook(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	w := httptest.NewRecorder()
+	var recovered interface{}
+	var stack []byte
+	onPanic := func(w http.ResponseWriter, r *http.Request, rec interface{}, s []byte) {
+		recovered, stack = rec, s
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	handler := Chain(Recover(onPanic), appendHeader("A")).Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panicInHandler()
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("StatusServiceUnavailable 503 expected from the hook but was %v", w.Code)
+	}
+	if recovered != "boom" {
+		t.Fatalf("Expected the recovered value boom but was %v", recovered)
+	}
+	if !strings.Contains(string(stack), "panicInHandler") {
+		t.Fatalf("Expected the stack trace to include the panicking function but was %s", stack)
+	}
+}
+
+// TestRecoverAbortHandler tests that http.ErrAbortHandler is re-panicked
+func TestRecoverAbortHandler(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/test", nil)
+	w := httptest.NewRecorder()
+	handler := Recover(nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		// Assert
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Fatalf("Expected http.ErrAbortHandler to be re-panicked but was %v", rec)
+		}
+	}()
+
+	// Act
+	handler.ServeHTTP(w, r)
+}
+
+// panicInHandler panics from a named function, so it can be found in the stack trace
+func panicInHandler() {
+	panic("boom")
+}
@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Renderer serializes the data set by a handler using SetRenderData
+type Renderer interface {
+	Render(w io.Writer, data interface{}) error
+}
+
+// RendererFunc is an adapter to allow the use of ordinary functions as Renderers
+type RendererFunc func(w io.Writer, data interface{}) error
+
+// Render calls f(w, data)
+func (f RendererFunc) Render(w io.Writer, data interface{}) error {
+	return f(w, data)
+}
+
+// JSONRenderer renders the data as JSON
+var JSONRenderer = RendererFunc(func(w io.Writer, data interface{}) error {
+	return json.NewEncoder(w).Encode(data)
+})
+
+// XMLRenderer renders the data as XML
+var XMLRenderer = RendererFunc(func(w io.Writer, data interface{}) error {
+	return xml.NewEncoder(w).Encode(data)
+})
+
+// CSVRenderer renders data, which must be a [][]string of records, as CSV
+var CSVRenderer = RendererFunc(func(w io.Writer, data interface{}) error {
+	records, ok := data.([][]string)
+	if !ok {
+		return errors.New("CSV render data must be a [][]string")
+	}
+	return csv.NewWriter(w).WriteAll(records)
+})
+
+// Render middleware lets a single handler serve multiple formats.
+// The handler sets its response data using SetRenderData, which is serialized by the renderer for the content type,
+// a key of renderers, negotiated from the request's Accept header. Ties are broken by the content type's alphabetical order.
+// A StatusNotAcceptable (406) is returned, without calling the handler, when no renderer matches.
+// The handler's status is kept. Handlers which don't set render data write their response as usual
+func Render(renderers map[string]Renderer) Middleware {
+
+	offers := make([]string, 0, len(renderers))
+	for contentType := range renderers {
+		offers = append(offers, contentType)
+	}
+	sort.Strings(offers)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			contentType := negotiateContentType(r.Header.Get("Accept"), offers)
+			if contentType == "" {
+				w.WriteHeader(http.StatusNotAcceptable)
+				return
+			}
+
+			holder := &renderData{}
+			ctx := context.WithValue(r.Context(), renderDataKey, holder)
+			sw := &statusWriter{rw: w, buf: bytes.NewBuffer(nil)}
+			next.ServeHTTP(sw, r.WithContext(ctx))
+
+			if data, ok := holder.get(); ok {
+				body := bytes.NewBuffer(nil)
+				if err := renderers[contentType].Render(body, data); err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set("Content-Type", contentType)
+				sw.buf = body
+			}
+			sw.Finish()
+		})
+	}
+}
+
+// render data context key
+var renderDataKey = &contextKey{"RenderData"}
+
+// renderData holds the data set by the handler
+type renderData struct {
+	mu   sync.Mutex
+	data interface{}
+	set  bool
+}
+
+// get gets the data set by the handler, and whether it was set
+func (rd *renderData) get() (interface{}, bool) {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	return rd.data, rd.set
+}
+
+// SetRenderData sets the data the Render middleware serializes as the response.
+// It returns false if the Render middleware isn't in use
+func SetRenderData(ctx context.Context, data interface{}) bool {
+	rd, ok := ctx.Value(renderDataKey).(*renderData)
+	if !ok {
+		return false
+	}
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	rd.data = data
+	rd.set = true
+	return true
+}
+
+// negotiateContentType picks the offered content type most preferred by the Accept header, or "" if none are acceptable.
+// Each offer's q value comes from the most specific range matching it, so "application/json;q=0, */*" refuses JSON.
+// Offers with a q value of 0 are unacceptable. A missing Accept header accepts any content type
+func negotiateContentType(accept string, offers []string) string {
+	if strings.TrimSpace(accept) == "" {
+		accept = "*/*"
+	}
+
+	type acceptRange struct {
+		mediaType string
+		q         float64
+	}
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType, q})
+	}
+
+	best, bestQ, bestSpecificity := "", 0.0, -1
+	for _, offer := range offers {
+		q, specificity := 0.0, -1
+		for _, ar := range ranges {
+			if s := mediaTypeSpecificity(ar.mediaType, offer); s > specificity {
+				q, specificity = ar.q, s
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		if q > bestQ || (q == bestQ && specificity > bestSpecificity) {
+			best, bestQ, bestSpecificity = offer, q, specificity
+		}
+	}
+	return best
+}
+
+// mediaTypeSpecificity returns how specifically the accepted media type matches the offer:
+// 2 for an exact match, 1 for type/*, 0 for */* & -1 when it doesn't match
+func mediaTypeSpecificity(accepted, offer string) int {
+	switch {
+	case accepted == offer:
+		return 2
+	case accepted == "*/*":
+		return 0
+	case strings.HasSuffix(accepted, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(accepted, "*")):
+		return 1
+	}
+	return -1
+}
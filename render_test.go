@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// renderUsers is a handler which sets the same user records as its render data whatever the format
+var renderUsers = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	SetRenderData(r.Context(), [][]string{{"id", "name"}, {"1", "Ada"}})
+})
+
+// testRenderers are the renderers used by the Render tests
+var testRenderers = map[string]Renderer{
+	"application/json": JSONRenderer,
+	"text/csv":         CSVRenderer,
+}
+
+// TestRenderFormats tests that the same handler data is rendered as JSON or CSV depending on the Accept header
+func TestRenderFormats(t *testing.T) {
+
+	tests := []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"application/json", "application/json", `[["id","name"],["1","Ada"]]`},
+		{"text/csv", "text/csv", "id,name\n1,Ada"},
+		{"text/*;q=0.9, application/json;q=0.5", "text/csv", "id,name\n1,Ada"},
+		{"", "application/json", `[["id","name"],["1","Ada"]]`},
+		{"application/json;q=0, */*", "text/csv", "id,name\n1,Ada"},
+		{"text/*;q=0.5, text/csv;q=0.1, application/json;q=0.3", "application/json", `[["id","name"],["1","Ada"]]`},
+	}
+
+	for _, test := range tests {
+
+		// Arrange
+		r, _ := http.NewRequest("GET", "/users", nil)
+		r.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+		handler := Render(testRenderers)(renderUsers)
+
+		// Act
+		handler.ServeHTTP(w, r)
+
+		// Assert
+		if w.Code != http.StatusOK {
+			t.Fatalf("StatusOK 200 expected for Accept %s but was %v", test.accept, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != test.contentType {
+			t.Fatalf("Expected Content-Type %s for Accept %s but was %s", test.contentType, test.accept, ct)
+		}
+		if body := strings.TrimSpace(w.Body.String()); body != test.body {
+			t.Fatalf("Expected body %s for Accept %s but was %s", test.body, test.accept, body)
+		}
+	}
+}
+
+// TestRenderNotAcceptable tests that StatusNotAcceptable is returned when no renderer matches the Accept header
+func TestRenderNotAcceptable(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/users", nil)
+	r.Header.Set("Accept", "application/xml")
+	w := httptest.NewRecorder()
+	handler := Render(testRenderers)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusNotAcceptable {
+		t.Fatalf("StatusNotAcceptable 406 expected but was %v", w.Code)
+	}
+}
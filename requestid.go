@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+)
+
+// RequestIDOptions defines the user supplied RequestID configuration options.
+type RequestIDOptions struct {
+	// Header is the request & response header holding the request ID. Default: X-Request-ID
+	Header string
+	// Generator generates the ID of requests which don't supply one, e.g. a deterministic sequence for tests.
+	// Default: a random 128 bit hex ID
+	Generator func() (string, error)
+}
+
+// RequestID middleware gives each request a unique ID, for tracing, which is stored in the request context
+// & echoed in the X-Request-ID response header. A request ID supplied in the X-Request-ID request header is used as is,
+// otherwise a random ID is generated. Use GetRequestID to get the ID downstream
+func RequestID() Middleware {
+	return RequestIDWithOptions(RequestIDOptions{})
+}
+
+// RequestIDWithOptions middleware gives each request a unique ID, like RequestID, using the user supplied options.
+// A StatusInternalServerError (500) is returned if the ID can't be generated
+func RequestIDWithOptions(opts RequestIDOptions) Middleware {
+	if opts.Header == "" {
+		opts.Header = "X-Request-ID"
+	}
+	if opts.Generator == nil {
+		opts.Generator = randomRequestID
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(opts.Header)
+			if id == "" {
+				var err error
+				id, err = opts.Generator()
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+			}
+
+			w.Header().Set(opts.Header, id)
+			ctx := context.WithValue(r.Context(), requestIDKey, id)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ContentRequestID middleware adds a request ID to the request context & the X-Request-ID response header.
+// A request ID supplied in the X-Request-ID request header is used as is. Otherwise the ID is derived from
+// a hash of the method, path, query & body, so that identical requests get identical IDs, which are useful
+// for deduplication & as idempotency key defaults. Requests without a body get a random ID
+func ContentRequestID() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get("X-Request-ID")
+			if id == "" {
+				var err error
+				id, err = contentRequestID(r)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+			}
+
+			w.Header().Set("X-Request-ID", id)
+			ctx := context.WithValue(r.Context(), requestIDKey, id)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// request id context key
+var requestIDKey = &contextKey{"RequestID"}
+
+// GetRequestID gets the request ID stored in the context, or "" if there isn't one
+func GetRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// contentRequestID derives the request ID from a hash of the request's content, or a random ID if it doesn't have a body.
+// The body is buffered & replaced so that it can still be read by the handler
+func contentRequestID(r *http.Request) (string, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	if len(body) == 0 {
+		return randomRequestID()
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + "\n" + r.URL.RequestURI() + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil)[:16]), nil
+}
+
+// randomRequestID generates a random 128 bit request ID
+func randomRequestID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
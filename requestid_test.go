@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveRequestID serves the request using ContentRequestID & returns the request ID the handler saw
+func serveRequestID(t *testing.T, r *http.Request) string {
+	var id string
+	handler := ContentRequestID()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = GetRequestID(r.Context())
+		if r.Body != nil {
+			if _, err := ioutil.ReadAll(r.Body); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if h := w.Header().Get("X-Request-ID"); h != id {
+		t.Fatalf("Expected the X-Request-ID response header %s but was %s", id, h)
+	}
+	return id
+}
+
+// TestContentRequestIDIdenticalRequests tests that identical requests are given the same derived ID
+func TestContentRequestIDIdenticalRequests(t *testing.T) {
+
+	// Arrange
+	r1, _ := http.NewRequest("POST", "/orders", strings.NewReader(`{"item":1}`))
+	r2, _ := http.NewRequest("POST", "/orders", strings.NewReader(`{"item":1}`))
+
+	// Act
+	id1 := serveRequestID(t, r1)
+	id2 := serveRequestID(t, r2)
+
+	// Assert
+	if id1 == "" || id1 != id2 {
+		t.Fatalf("Expected identical requests to have the same ID but were %s & %s", id1, id2)
+	}
+}
+
+// TestContentRequestIDDifferentRequests tests that requests with different content are given different IDs
+func TestContentRequestIDDifferentRequests(t *testing.T) {
+
+	// Arrange
+	r1, _ := http.NewRequest("POST", "/orders", strings.NewReader(`{"item":1}`))
+	r2, _ := http.NewRequest("POST", "/orders", strings.NewReader(`{"item":2}`))
+	r3, _ := http.NewRequest("PUT", "/orders", strings.NewReader(`{"item":1}`))
+
+	// Act
+	id1 := serveRequestID(t, r1)
+	id2 := serveRequestID(t, r2)
+	id3 := serveRequestID(t, r3)
+
+	// Assert
+	if id1 == id2 || id1 == id3 {
+		t.Fatalf("Expected different requests to have different IDs but were %s, %s & %s", id1, id2, id3)
+	}
+}
+
+// TestContentRequestIDEmptyBody tests that requests without a body are given random IDs
+func TestContentRequestIDEmptyBody(t *testing.T) {
+
+	// Arrange
+	r1, _ := http.NewRequest("GET", "/orders", nil)
+	r2, _ := http.NewRequest("GET", "/orders", nil)
+
+	// Act
+	id1 := serveRequestID(t, r1)
+	id2 := serveRequestID(t, r2)
+
+	// Assert
+	if id1 == "" || id1 == id2 {
+		t.Fatalf("Expected random IDs but were %s & %s", id1, id2)
+	}
+}
+
+// TestContentRequestIDSupplied tests that a supplied X-Request-ID is used as is
+func TestContentRequestIDSupplied(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/orders", strings.NewReader(`{"item":1}`))
+	r.Header.Set("X-Request-ID", "abc-123")
+
+	// Act
+	id := serveRequestID(t, r)
+
+	// Assert
+	if id != "abc-123" {
+		t.Fatalf("Expected the supplied ID abc-123 but was %s", id)
+	}
+}
+
+// TestRequestIDSupplied tests that a request ID supplied in the X-Request-ID header is preserved
+func TestRequestIDSupplied(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/orders", nil)
+	r.Header.Set("X-Request-ID", "abc-123")
+	w := httptest.NewRecorder()
+	var id string
+	handler := RequestID()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = GetRequestID(r.Context())
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if id != "abc-123" {
+		t.Fatalf("Expected the supplied ID abc-123 but was %s", id)
+	}
+	if h := w.Header().Get("X-Request-ID"); h != "abc-123" {
+		t.Fatalf("Expected the X-Request-ID response header abc-123 but was %s", h)
+	}
+}
+
+// TestRequestIDGenerated tests that a request without an ID is given one by the generator
+func TestRequestIDGenerated(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/orders", nil)
+	w := httptest.NewRecorder()
+	var id string
+	options := RequestIDOptions{Generator: func() (string, error) { return "generated-1", nil }}
+	handler := RequestIDWithOptions(options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = GetRequestID(r.Context())
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if id != "generated-1" {
+		t.Fatalf("Expected the generated ID generated-1 but was %s", id)
+	}
+	if h := w.Header().Get("X-Request-ID"); h != "generated-1" {
+		t.Fatalf("Expected the X-Request-ID response header generated-1 but was %s", h)
+	}
+}
+
+// TestRequestIDRandom tests that requests without an ID are given distinct random IDs by default
+func TestRequestIDRandom(t *testing.T) {
+
+	// Arrange
+	ids := map[string]bool{}
+	handler := RequestID()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids[GetRequestID(r.Context())] = true
+	}))
+
+	// Act
+	for i := 0; i < 2; i++ {
+		r, _ := http.NewRequest("GET", "/orders", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	// Assert
+	if len(ids) != 2 || ids[""] {
+		t.Fatalf("Expected 2 distinct generated IDs but was %v", ids)
+	}
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SchemaGuardOptions defines the user supplied SchemaGuard configuration options.
+type SchemaGuardOptions struct {
+	// ExpectedVersion is the schema version the app was built against
+	ExpectedVersion int
+	// Query returns the database's current schema version as a single integer
+	// Default: SELECT MAX(version) FROM schema_migrations
+	Query string
+	// CacheTTL is how long the result of a check, matching or not, is cached before the version is queried again. Default: 5 seconds
+	CacheTTL time.Duration
+	// QueryTimeout bounds the version query, which runs on its own context so that a client disconnecting mid check
+	// doesn't fail it. Default: 5 seconds
+	QueryTimeout time.Duration
+}
+
+// SchemaGuard middleware refuses traffic with a StatusServiceUnavailable (503) until the database schema version matches expectedVersion.
+// It prevents a freshly deployed app from writing against an un-migrated database.
+// The version is checked on the first request & the result, matching or not, is cached for the CacheTTL unless the check timed out. Mismatches are logged
+// & rechecked once the result expires, so that traffic is accepted soon after the migrations have run
+func SchemaGuard(db *sql.DB, expectedVersion int) Middleware {
+	return SchemaGuardWithOptions(db, SchemaGuardOptions{ExpectedVersion: expectedVersion})
+}
+
+// SchemaGuardWithOptions middleware is SchemaGuard configured with the supplied SchemaGuardOptions
+func SchemaGuardWithOptions(db *sql.DB, options SchemaGuardOptions) Middleware {
+	return schemaGuard(db, options, time.Now)
+}
+
+// schemaGuard is SchemaGuardWithOptions using the supplied clock to expire the cached result
+func schemaGuard(db *sql.DB, options SchemaGuardOptions, now func() time.Time) Middleware {
+
+	if options.Query == "" {
+		options.Query = "SELECT MAX(version) FROM schema_migrations"
+	}
+	if options.CacheTTL <= 0 {
+		options.CacheTTL = 5 * time.Second
+	}
+	if options.QueryTimeout <= 0 {
+		options.QueryTimeout = 5 * time.Second
+	}
+
+	var mu sync.Mutex
+	var matched, checked, checking bool
+	var expires time.Time
+
+	// checkVersion queries the schema version, unless the cached result is still valid.
+	// The query runs outside the lock, & while one request rechecks an expired result the others use it.
+	// A query which timed out isn't cached, so the next request checks again
+	checkVersion := func() bool {
+		mu.Lock()
+		if checked && (checking || now().Before(expires)) {
+			defer mu.Unlock()
+			return matched
+		}
+		checking = true
+		mu.Unlock()
+
+		result, err := queryVersion(db, options)
+
+		mu.Lock()
+		defer mu.Unlock()
+		checking = false
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false
+		}
+		matched, checked = result, true
+		expires = now().Add(options.CacheTTL)
+		return matched
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !checkVersion() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// queryVersion checks if the database's schema version matches the expected version, logging any mismatch or error.
+// The query runs on a background context, bounded by the QueryTimeout, rather than any one request's
+func queryVersion(db *sql.DB, options SchemaGuardOptions) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), options.QueryTimeout)
+	defer cancel()
+
+	var version int
+	if err := db.QueryRowContext(ctx, options.Query).Scan(&version); err != nil {
+		log.Printf("middleware: checking the schema version failed: %v", err)
+		return false, err
+	}
+	if version != options.ExpectedVersion {
+		log.Printf("middleware: schema version %d doesn't match the expected version %d", version, options.ExpectedVersion)
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// TestSchemaGuardMatchingVersion tests that requests are passed on when the schema version matches, & that the version is only checked once
+func TestSchemaGuardMatchingVersion(t *testing.T) {
+
+	// Arrange
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectQuery("SELECT MAX\\(version\\) FROM schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(7))
+
+	handler := SchemaGuard(db, 7)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	for i := 0; i < 2; i++ {
+		r, _ := http.NewRequest("GET", "/", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		// Assert
+		if w.Code != http.StatusOK {
+			t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unmet sql expectations: %v", err)
+	}
+}
+
+// TestSchemaGuardMismatchedVersion tests that StatusServiceUnavailable is returned when the schema version doesn't match
+func TestSchemaGuardMismatchedVersion(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectQuery("SELECT version FROM migrations").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(6))
+
+	options := SchemaGuardOptions{ExpectedVersion: 7, Query: "SELECT version FROM migrations"}
+	handler := SchemaGuardWithOptions(db, options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("StatusServiceUnavailable 503 expected but was %v", w.Code)
+	}
+}
+
+// TestSchemaGuardMismatchCached tests that a mismatch is cached for the CacheTTL rather than queried on every request,
+// & that the version is queried again once the result expires
+func TestSchemaGuardMismatchCached(t *testing.T) {
+
+	// Arrange
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectQuery("SELECT MAX\\(version\\) FROM schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(6))
+	mock.ExpectQuery("SELECT MAX\\(version\\) FROM schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(7))
+
+	now := time.Now()
+	handler := schemaGuard(db, SchemaGuardOptions{ExpectedVersion: 7, CacheTTL: time.Minute}, func() time.Time { return now })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func() int {
+		r, _ := http.NewRequest("GET", "/", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// Act
+	first := serve()
+	cached := serve()
+	now = now.Add(time.Minute)
+	rechecked := serve()
+
+	// Assert
+	if first != http.StatusServiceUnavailable || cached != http.StatusServiceUnavailable {
+		t.Fatalf("StatusServiceUnavailable 503 expected until the result expires but was %v & %v", first, cached)
+	}
+	if rechecked != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected once the version is rechecked but was %v", rechecked)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unmet sql expectations: %v", err)
+	}
+}
+
+// TestSchemaGuardAbortedCheckNotCached tests that an aborted request doesn't fail the check, & that a check which
+// timed out isn't cached, so the next healthy request passes
+func TestSchemaGuardAbortedCheckNotCached(t *testing.T) {
+
+	// Arrange
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectQuery("SELECT MAX\\(version\\) FROM schema_migrations").WillReturnError(context.DeadlineExceeded)
+	mock.ExpectQuery("SELECT MAX\\(version\\) FROM schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(7))
+
+	handler := SchemaGuard(db, 7)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	aborted, _ := http.NewRequest("GET", "/", nil)
+	aborted = aborted.WithContext(ctx)
+	healthy, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(httptest.NewRecorder(), aborted)
+	handler.ServeHTTP(w, healthy)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected after the aborted check but was %v", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unmet sql expectations: %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// RequireScope middleware requires the JWT claims to grant all of the scopes, e.g. RequireScope("orders:read", "orders:write").
+// Scopes are granted by the space delimited scope claim or the roles array claim.
+// A StatusForbidden (403) is returned when a scope is missing, & a StatusUnauthorized (401) when there are no claims,
+// i.e. the request wasn't authenticated. It's chained after JWT, e.g. Chain(JWT(options), RequireScope("admin"))
+func RequireScope(scopes ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := GetClaims(r.Context())
+			if claims == nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			granted := grantedScopes(claims)
+			for _, scope := range scopes {
+				if !containsString(granted, scope) {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// grantedScopes gets the scopes granted by the space delimited scope claim & the roles array claim
+func grantedScopes(claims jwt.MapClaims) []string {
+	var granted []string
+	if scope, ok := claims["scope"].(string); ok {
+		granted = append(granted, strings.Fields(scope)...)
+	}
+	if roles, ok := claims["roles"].([]interface{}); ok {
+		for _, role := range roles {
+			if s, ok := role.(string); ok {
+				granted = append(granted, s)
+			}
+		}
+	}
+	return granted
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// TestRequireScopeSufficient tests that claims granting all the scopes, by scope or roles, reach the next handler
+func TestRequireScopeSufficient(t *testing.T) {
+
+	tests := []jwt.MapClaims{
+		{"scope": "orders:read orders:write profile"},
+		{"roles": []interface{}{"orders:write", "orders:read"}},
+		{"scope": "orders:read", "roles": []interface{}{"orders:write"}},
+	}
+
+	for _, claims := range tests {
+
+		// Arrange
+		r, _ := http.NewRequest("GET", "/", nil)
+		r = r.WithContext(setClaims(r.Context(), claims))
+		w := httptest.NewRecorder()
+		handler := RequireScope("orders:read", "orders:write")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		// Act
+		handler.ServeHTTP(w, r)
+
+		// Assert
+		if w.Code != http.StatusOK {
+			t.Fatalf("StatusOK 200 expected for claims %v but was %v", claims, w.Code)
+		}
+	}
+}
+
+// TestRequireScopeInsufficient tests that claims missing a scope are forbidden
+func TestRequireScopeInsufficient(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	r = r.WithContext(setClaims(r.Context(), jwt.MapClaims{"scope": "orders:read", "roles": []interface{}{"user"}}))
+	w := httptest.NewRecorder()
+	handler := RequireScope("orders:read", "orders:write")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("StatusForbidden 403 expected but was %v", w.Code)
+	}
+}
+
+// TestRequireScopeAfterJWT tests that RequireScope can be chained after JWT
+func TestRequireScopeAfterJWT(t *testing.T) {
+
+	// Arrange
+	secret := []byte("SECRET_SSSHHHHHHH")
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"scope": "profile"}).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Add("Authorization", "Bearer "+tokenString)
+	w := httptest.NewRecorder()
+	handler := Chain(JWT(JWTOptions{Secret: secret}), RequireScope("admin")).Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("StatusForbidden 403 expected but was %v", w.Code)
+	}
+}
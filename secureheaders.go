@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// SecureHeadersOptions defines the user supplied SecureHeaders configuration options.
+// Empty values use the defaults
+type SecureHeadersOptions struct {
+	// ContentTypeOptions is the X-Content-Type-Options header. Default: nosniff
+	ContentTypeOptions string
+	// FrameOptions is the X-Frame-Options header. Default: DENY
+	FrameOptions string
+	// ReferrerPolicy is the Referrer-Policy header. Default: strict-origin-when-cross-origin
+	ReferrerPolicy string
+	// ContentSecurityPolicy is the Content-Security-Policy header. Default: default-src 'self'
+	ContentSecurityPolicy string
+	// Disable lists the headers, e.g. Content-Security-Policy, which aren't set
+	Disable []string
+}
+
+// SecureHeaders middleware sets a default set of security headers on every response: X-Content-Type-Options,
+// X-Frame-Options, Referrer-Policy & Content-Security-Policy. Individual headers can be overridden or disabled using the options.
+// The headers are set before calling the next handler, so a handler can still override them for its own response
+func SecureHeaders(opts SecureHeadersOptions) Middleware {
+	headers := map[string]string{
+		"X-Content-Type-Options":  defaultString(opts.ContentTypeOptions, "nosniff"),
+		"X-Frame-Options":         defaultString(opts.FrameOptions, "DENY"),
+		"Referrer-Policy":         defaultString(opts.ReferrerPolicy, "strict-origin-when-cross-origin"),
+		"Content-Security-Policy": defaultString(opts.ContentSecurityPolicy, "default-src 'self'"),
+	}
+	for _, disabled := range opts.Disable {
+		delete(headers, http.CanonicalHeaderKey(disabled))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for header, value := range headers {
+				w.Header().Set(header, value)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// defaultString returns s, or the default if s is empty
+func defaultString(s string, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
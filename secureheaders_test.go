@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestSecureHeadersDefaults tests that the default security headers are set
+func TestSecureHeadersDefaults(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler := SecureHeaders(SecureHeadersOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	expected := map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"X-Frame-Options":         "DENY",
+		"Referrer-Policy":         "strict-origin-when-cross-origin",
+		"Content-Security-Policy": "default-src 'self'",
+	}
+	for header, value := range expected {
+		if h := w.Header().Get(header); h != value {
+			t.Fatalf("Expected the %s header %s but was %s", header, value, h)
+		}
+	}
+}
+
+// TestSecureHeadersOverride tests that headers can be overridden by the options & the handler, & disabled
+func TestSecureHeadersOverride(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	options := SecureHeadersOptions{FrameOptions: "SAMEORIGIN", Disable: []string{"content-security-policy"}}
+	handler := SecureHeaders(options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if h := w.Header().Get("X-Frame-Options"); h != "SAMEORIGIN" {
+		t.Fatalf("Expected the overridden X-Frame-Options header SAMEORIGIN but was %s", h)
+	}
+	if h := w.Header().Get("Referrer-Policy"); h != "no-referrer" {
+		t.Fatalf("Expected the handler's Referrer-Policy header no-referrer but was %s", h)
+	}
+	if h := w.Header().Get("Content-Security-Policy"); h != "" {
+		t.Fatalf("Expected the Content-Security-Policy header to be disabled but was %s", h)
+	}
+}
@@ -0,0 +1,248 @@
+package middleware
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SessionFunc defines a user supplied authorisation function.
+// The func is given the current context and the values stored in a valid session cookie.
+// The context returned will be used as the context for further chained http handlers.
+// Session authorisation fails if this returns an error, and further chained http handlers are not called.
+type SessionFunc func(context.Context, map[string]interface{}) (context.Context, error)
+
+// SessionOptions defines the user supplied CookieSession configuration options.
+type SessionOptions struct {
+	// Secret used to sign the session cookie using HMAC-SHA256. It's required, as anyone could forge a session signed with an empty key
+	Secret []byte
+	// EncryptionKey encrypts the session cookie using AES-GCM when set. It must be 16, 24 or 32 bytes long
+	// Default: the session cookie is signed but not encrypted
+	EncryptionKey []byte
+	// CookieName is the name of the session cookie. Default: "session"
+	CookieName string
+	// MaxAge is how long an issued session is valid for. Default: 24 hours
+	MaxAge time.Duration
+	// Path, Domain & Secure are the session cookie's attributes. Default: Path "/"
+	Path   string
+	Domain string
+	Secure bool
+	// AuthFunc is called with the session's values once the session cookie is validated
+	AuthFunc SessionFunc
+}
+
+// CookieSession middleware is an alternative to Auth & JWT which authenticates requests using a signed session cookie.
+// The cookie is issued by IssueSession & removed by ClearSession.
+// StatusUnauthorized (401) is returned when the cookie is missing, has been tampered with or has expired.
+// The session's values can be read by later handlers using GetSession.
+// It panics if the options don't have a Secret, or the EncryptionKey isn't a valid AES key
+func CookieSession(options SessionOptions) Middleware {
+
+	if len(options.Secret) == 0 {
+		panic("CookieSession requires a Secret")
+	}
+	if len(options.EncryptionKey) > 0 {
+		if _, err := newSessionCipher(options.EncryptionKey); err != nil {
+			panic("CookieSession has an invalid EncryptionKey: " + err.Error())
+		}
+	}
+	options = withSessionDefaults(options)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cookie, err := r.Cookie(options.CookieName)
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			values, err := decodeSession(options, cookie.Value, time.Now())
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), sessionKey, values)
+			if options.AuthFunc != nil {
+				ctx, err = options.AuthFunc(ctx, values)
+				if err != nil {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// session context key
+var sessionKey = &contextKey{"Session"}
+
+// GetSession gets the session values stored in the context, or nil if there isn't a session
+func GetSession(ctx context.Context) map[string]interface{} {
+	values, _ := ctx.Value(sessionKey).(map[string]interface{})
+	return values
+}
+
+// ErrMissingSessionSecret is returned by IssueSession when the options don't have a Secret to sign the session with
+var ErrMissingSessionSecret = errors.New("Session Secret is required")
+
+// IssueSession sets a session cookie containing the values, which is valid for the configured MaxAge.
+// The values must be JSON encodable.
+func IssueSession(w http.ResponseWriter, options SessionOptions, values map[string]interface{}) error {
+
+	if len(options.Secret) == 0 {
+		return ErrMissingSessionSecret
+	}
+	options = withSessionDefaults(options)
+	expires := time.Now().Add(options.MaxAge)
+
+	value, err := encodeSession(options, values, expires)
+	if err != nil {
+		return err
+	}
+
+	cookie := sessionCookie(options)
+	cookie.Value = value
+	cookie.Expires = expires
+	cookie.MaxAge = int(options.MaxAge.Seconds())
+	http.SetCookie(w, cookie)
+	return nil
+}
+
+// ClearSession removes the session cookie
+func ClearSession(w http.ResponseWriter, options SessionOptions) {
+	cookie := sessionCookie(withSessionDefaults(options))
+	cookie.Expires = time.Unix(0, 0)
+	cookie.MaxAge = -1
+	http.SetCookie(w, cookie)
+}
+
+// withSessionDefaults fills in the defaults for options the user didn't supply
+func withSessionDefaults(options SessionOptions) SessionOptions {
+	if options.CookieName == "" {
+		options.CookieName = "session"
+	}
+	if options.MaxAge == 0 {
+		options.MaxAge = 24 * time.Hour
+	}
+	if options.Path == "" {
+		options.Path = "/"
+	}
+	return options
+}
+
+// sessionCookie creates the session cookie with the configured attributes
+func sessionCookie(options SessionOptions) *http.Cookie {
+	return &http.Cookie{
+		Name:     options.CookieName,
+		Path:     options.Path,
+		Domain:   options.Domain,
+		Secure:   options.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// sessionPayload is the content of the session cookie
+type sessionPayload struct {
+	Expires int64                  `json:"exp"`
+	Values  map[string]interface{} `json:"values"`
+}
+
+// encodeSession creates the session cookie value in the format {base64 payload}.{base64 signature}
+// The payload is encrypted first, when an encryption key is configured
+func encodeSession(options SessionOptions, values map[string]interface{}, expires time.Time) (string, error) {
+
+	payload, err := json.Marshal(sessionPayload{Expires: expires.Unix(), Values: values})
+	if err != nil {
+		return "", err
+	}
+
+	if options.EncryptionKey != nil {
+		gcm, err := newSessionCipher(options.EncryptionKey)
+		if err != nil {
+			return "", err
+		}
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return "", err
+		}
+		payload = gcm.Seal(nonce, nonce, payload, nil)
+	}
+
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+	signature := base64.RawURLEncoding.EncodeToString(signSession(options.Secret, encodedPayload))
+	return encodedPayload + "." + signature, nil
+}
+
+// decodeSession validates the session cookie value's signature & expiry, returning its values
+func decodeSession(options SessionOptions, value string, now time.Time) (map[string]interface{}, error) {
+
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 {
+		return nil, errors.New("Session cookie format must be {payload}.{signature}")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, signSession(options.Secret, parts[0])) {
+		return nil, errors.New("Session cookie signature is invalid")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if options.EncryptionKey != nil {
+		gcm, err := newSessionCipher(options.EncryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		if len(payload) < gcm.NonceSize() {
+			return nil, errors.New("Session cookie is too short")
+		}
+		payload, err = gcm.Open(nil, payload[:gcm.NonceSize()], payload[gcm.NonceSize():], nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var session sessionPayload
+	if err := json.Unmarshal(payload, &session); err != nil {
+		return nil, err
+	}
+	if now.Unix() >= session.Expires {
+		return nil, errors.New("Session has expired")
+	}
+	if session.Values == nil {
+		session.Values = map[string]interface{}{}
+	}
+	return session.Values, nil
+}
+
+// signSession creates the HMAC-SHA256 signature of the encoded payload
+func signSession(secret []byte, encodedPayload string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(encodedPayload))
+	return mac.Sum(nil)
+}
+
+// newSessionCipher creates the AES-GCM cipher used to encrypt sessions
+func newSessionCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
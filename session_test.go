@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var sessionOptions = SessionOptions{
+	Secret:        []byte("SECRET_SSSHHHHHHH"),
+	EncryptionKey: []byte("0123456789abcdef0123456789abcdef"),
+}
+
+// issueTestSession issues a session & returns the resulting cookie
+func issueTestSession(t *testing.T, options SessionOptions, values map[string]interface{}) *http.Cookie {
+	w := httptest.NewRecorder()
+	if err := IssueSession(w, options, values); err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Expected 1 session cookie but got %v", len(cookies))
+	}
+	return cookies[0]
+}
+
+// TestCookieSessionValid tests that a valid session cookie calls the next handler with the session's values
+func TestCookieSessionValid(t *testing.T) {
+
+	// Arrange
+	cookie := issueTestSession(t, sessionOptions, map[string]interface{}{"user": "test@test.com"})
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	handler := CookieSession(sessionOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if GetSession(r.Context())["user"] != "test@test.com" {
+			t.Fatal("Expected user to be set in the session")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
+
+// TestCookieSessionTampered tests that StatusUnauthorized is returned when the session cookie has been tampered with
+func TestCookieSessionTampered(t *testing.T) {
+
+	// Arrange
+	cookie := issueTestSession(t, sessionOptions, map[string]interface{}{"user": "test@test.com"})
+	tampered := []byte(cookie.Value)
+	tampered[0] ^= 1
+	cookie.Value = string(tampered)
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	handler := CookieSession(sessionOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("StatusUnauthorized 401 expected but was %v", w.Code)
+	}
+}
+
+// TestCookieSessionExpired tests that StatusUnauthorized is returned when the session has expired
+func TestCookieSessionExpired(t *testing.T) {
+
+	// Arrange
+	value, err := encodeSession(sessionOptions, map[string]interface{}{"user": "test@test.com"}, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "session", Value: value})
+	w := httptest.NewRecorder()
+	handler := CookieSession(sessionOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("StatusUnauthorized 401 expected but was %v", w.Code)
+	}
+}
+
+// TestCookieSessionMissing tests that StatusUnauthorized is returned when there is no session cookie
+func TestCookieSessionMissing(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler := CookieSession(sessionOptions)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("StatusUnauthorized 401 expected but was %v", w.Code)
+	}
+}
+
+// TestCookieSessionMissingSecret tests that a session can't be configured without a Secret
+func TestCookieSessionMissingSecret(t *testing.T) {
+
+	// Arrange
+	options := SessionOptions{EncryptionKey: sessionOptions.EncryptionKey}
+	defer func() {
+		// Assert
+		if recover() == nil {
+			t.Fatal("Expected a panic for a missing Secret")
+		}
+	}()
+
+	// Act
+	if err := IssueSession(httptest.NewRecorder(), options, map[string]interface{}{"sub": "1"}); err != ErrMissingSessionSecret {
+		t.Fatalf("Expected ErrMissingSessionSecret issuing a session but was %v", err)
+	}
+	CookieSession(options)
+}
+
+// TestCookieSessionInvalidEncryptionKey tests that a session can't be configured with an EncryptionKey of the wrong length
+func TestCookieSessionInvalidEncryptionKey(t *testing.T) {
+
+	// Arrange
+	options := SessionOptions{Secret: sessionOptions.Secret, EncryptionKey: []byte("too-short")}
+	defer func() {
+		// Assert
+		if recover() == nil {
+			t.Fatal("Expected a panic for an invalid EncryptionKey")
+		}
+	}()
+
+	// Act
+	CookieSession(options)
+}
+
+// TestClearSession tests that ClearSession expires the session cookie
+func TestClearSession(t *testing.T) {
+
+	// Arrange
+	w := httptest.NewRecorder()
+
+	// Act
+	ClearSession(w, sessionOptions)
+
+	// Assert
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "session" || cookies[0].MaxAge != -1 {
+		t.Fatalf("Expected the session cookie to be expired but got %v", cookies)
+	}
+}
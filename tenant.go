@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// tenant context key
+var tenantKey = &contextKey{"Tenant"}
+
+// SetTenant creates a child context with the tenant the request is made on behalf of.
+// It's typically called from an AuthFunc or JWTFunc once the user is known
+func SetTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey, tenant)
+}
+
+// GetTenant gets the tenant stored in the context, or an empty string if there isn't one
+func GetTenant(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey).(string)
+	return tenant
+}
+
+// TenantConcurrencyLimit middleware caps the number of requests, and therefore database transactions,
+// each tenant can have in flight at the same time. It stops a single noisy tenant from using up shared database resources.
+// The tenant is read from the request context using GetTenant, so it must run after the middleware which sets it, and before Transaction.
+// Requests over the limit get a StatusTooManyRequests (429). A slot is released once the handler completes.
+// Requests without a tenant, e.g. health checks, aren't limited. The limit is shared by every handler the Middleware wraps
+func TenantConcurrencyLimit(max int) Middleware {
+	limiter := &tenantLimiter{max: max, inFlight: map[string]int{}}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenant := GetTenant(r.Context())
+			if tenant == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !limiter.acquire(tenant) {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			defer limiter.release(tenant)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// tenantLimiter counts the requests in flight for each tenant
+type tenantLimiter struct {
+	mu       sync.Mutex
+	max      int
+	inFlight map[string]int
+}
+
+// acquire takes a slot for the tenant, returning false if all its slots are in use
+func (l *tenantLimiter) acquire(tenant string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight[tenant] >= l.max {
+		return false
+	}
+	l.inFlight[tenant]++
+	return true
+}
+
+// release frees up a slot for the tenant
+func (l *tenantLimiter) release(tenant string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight[tenant]--
+	if l.inFlight[tenant] == 0 {
+		delete(l.inFlight, tenant)
+	}
+}
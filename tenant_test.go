@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTenantRequest creates a request made on behalf of the tenant
+func newTenantRequest(tenant string) *http.Request {
+	r, _ := http.NewRequest("GET", "/", nil)
+	return r.WithContext(SetTenant(r.Context(), tenant))
+}
+
+// TestTenantConcurrencyLimitRejectsOverLimit tests that StatusTooManyRequests is returned once a tenant uses all its slots
+func TestTenantConcurrencyLimitRejectsOverLimit(t *testing.T) {
+
+	// Arrange
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	done := make(chan struct{})
+	handler := TenantConcurrencyLimit(1)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-finish
+		w.WriteHeader(http.StatusOK)
+	}))
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), newTenantRequest("tenant-a"))
+		close(done)
+	}()
+	<-started
+	w := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(w, newTenantRequest("tenant-a"))
+	close(finish)
+	<-done
+
+	// Assert
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("StatusTooManyRequests 429 expected but was %v", w.Code)
+	}
+}
+
+// TestTenantConcurrencyLimitPerTenant tests that each tenant is limited independently
+func TestTenantConcurrencyLimitPerTenant(t *testing.T) {
+
+	// Arrange
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	done := make(chan struct{})
+	handler := TenantConcurrencyLimit(1)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if GetTenant(r.Context()) == "tenant-a" {
+			started <- struct{}{}
+			<-finish
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), newTenantRequest("tenant-a"))
+		close(done)
+	}()
+	<-started
+	w := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(w, newTenantRequest("tenant-b"))
+	close(finish)
+	<-done
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
+
+// TestTenantConcurrencyLimitReleasesSlot tests that a slot is released once the handler completes
+func TestTenantConcurrencyLimitReleasesSlot(t *testing.T) {
+
+	// Arrange
+	handler := TenantConcurrencyLimit(1)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), newTenantRequest("tenant-a"))
+	w := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(w, newTenantRequest("tenant-a"))
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
+
+// TestTenantConcurrencyLimitNoTenant tests that requests without a tenant aren't limited, rather than sharing one "" tenant's slots
+func TestTenantConcurrencyLimitNoTenant(t *testing.T) {
+
+	// Arrange
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	done := make(chan struct{})
+	handler := TenantConcurrencyLimit(1)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started <- struct{}{}
+			<-finish
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	go func() {
+		r, _ := http.NewRequest("GET", "/slow", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		close(done)
+	}()
+	<-started
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(w, r)
+	close(finish)
+	<-done
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+}
+
+// TestTenantConcurrencyLimitShared tests that the limit is shared by every handler the Middleware wraps
+func TestTenantConcurrencyLimitShared(t *testing.T) {
+
+	// Arrange
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	done := make(chan struct{})
+	limit := TenantConcurrencyLimit(1)
+	slow := limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-finish
+	}))
+	fast := limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	go func() {
+		slow.ServeHTTP(httptest.NewRecorder(), newTenantRequest("tenant-a"))
+		close(done)
+	}()
+	<-started
+	w := httptest.NewRecorder()
+
+	// Act
+	fast.ServeHTTP(w, newTenantRequest("tenant-a"))
+	close(finish)
+	<-done
+
+	// Assert
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("StatusTooManyRequests 429 expected but was %v", w.Code)
+	}
+}
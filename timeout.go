@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Timeout middleware bounds how long the next handler has to respond. The request context is given a deadline of d,
+// & if it passes before the handler returns a StatusServiceUnavailable (503) is written & the context is canceled,
+// so that a Transaction within is rolled back & database calls using the context are abandoned.
+// The handler runs in its own goroutine & may still be running, & writing, after the timeout. Its response is buffered
+// & only written if it finishes in time, so later writes are discarded, returning http.ErrHandlerTimeout.
+// A panic in the handler is re-raised in the serving goroutine
+func Timeout(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			tw := &timeoutWriter{header: make(http.Header), buf: bytes.NewBuffer(nil)}
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					if rec := recover(); rec != nil {
+						panicked <- rec
+					}
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case rec := <-panicked:
+				panic(rec)
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				header := w.Header()
+				for k, v := range tw.header {
+					header[k] = v
+				}
+				if tw.status != 0 {
+					w.WriteHeader(tw.status)
+				}
+				w.Write(tw.buf.Bytes())
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers the handler's response so it can be discarded if the handler times out.
+// It's guarded by a mutex as the handler may still be writing when the timeout fires
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	status   int
+	buf      *bytes.Buffer
+	timedOut bool
+}
+
+// Header returns the buffered response headers
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+// WriteHeader sets the status of the buffered response. Only the first call is honoured
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+	tw.status = status
+}
+
+// Write buffers the body, returning http.ErrHandlerTimeout once the handler has timed out
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(b)
+}
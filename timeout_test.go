@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// TestTimeoutSlowHandler tests that a handler which doesn't respond in time gets a StatusServiceUnavailable (503),
+// its context is canceled & its later writes are discarded
+func TestTimeoutSlowHandler(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	writeErr := make(chan error, 1)
+	handler := Timeout(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		time.Sleep(10 * time.Millisecond)
+		_, err := w.Write([]byte("too late"))
+		writeErr <- err
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("StatusServiceUnavailable 503 expected but was %v", w.Code)
+	}
+	if err := <-writeErr; err != http.ErrHandlerTimeout {
+		t.Fatalf("Expected the late write to fail with http.ErrHandlerTimeout but was %v", err)
+	}
+	if w.Body.Len() != 0 {
+		t.Fatalf("Expected the late write to be discarded but was %s", w.Body.String())
+	}
+}
+
+// TestTimeoutFastHandler tests that a handler which responds in time passes through
+func TestTimeoutFastHandler(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler := Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusCreated || w.Body.String() != "created" {
+		t.Fatalf("Expected the handler's response but was %v %s", w.Code, w.Body.String())
+	}
+	if h := w.Header().Get("Content-Type"); h != "text/plain" {
+		t.Fatalf("Expected the handler's Content-Type header text/plain but was %s", h)
+	}
+}
+
+// TestTimeoutTransactionRollback tests that a transaction within a timed out request is rolled back
+func TestTimeoutTransactionRollback(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	finished := make(chan struct{})
+	signalFinished := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer close(finished)
+			next.ServeHTTP(w, r)
+		})
+	}
+	committed := false
+	handler := Chain(Timeout(10*time.Millisecond), signalFinished, Transaction(db)).Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		OnCommit(r.Context(), func() { committed = true })
+		<-r.Context().Done()
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+	<-finished
+
+	// Assert
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("StatusServiceUnavailable 503 expected but was %v", w.Code)
+	}
+	if committed {
+		t.Fatal("Expected the transaction to be rolled back but it was committed")
+	}
+}
@@ -1,59 +1,242 @@
 package middleware
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"database/sql"
+	"errors"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"sync"
+	"time"
 )
 
+// TransactionOptions defines the user supplied Transaction configuration options.
+type TransactionOptions struct {
+	// MaxBufferSize is the number of response bytes buffered before the response switches to streaming.
+	// Small responses are buffered so the transaction can still be rolled back, & the status replaced, if the commit fails.
+	// Once a response grows past MaxBufferSize the commit/rollback decision is locked in:
+	// the transaction is completed using the status & the body buffered so far, the buffer is flushed
+	// & the rest of the response is streamed to the client. A later panic can no longer change the status.
+	// Default: 0, the whole response is buffered
+	MaxBufferSize int
+	// TxOptions are passed straight to BeginTx, e.g. to start SERIALIZABLE or read only transactions
+	// Default: nil, the driver's default isolation level
+	TxOptions *sql.TxOptions
+	// ShouldCommit decides from the response status whether the transaction is committed or rolled back,
+	// e.g. to also commit 3xx redirects. Default: only successful (2xx) statuses are committed
+	ShouldCommit func(status int) bool
+	// MaxRetries is the number of times the handler is re-run, with a fresh transaction, when the commit fails with an error
+	// IsRetryable accepts, e.g. a serialization failure or deadlock under SERIALIZABLE isolation.
+	// The buffered response, & any headers the handler set, are discarded between attempts. The request body is buffered
+	// in memory so that each attempt can read it. Responses which have begun streaming are never retried. Default: 0, no retries
+	MaxRetries int
+	// IsRetryable decides whether the commit error can be retried
+	IsRetryable func(error) bool
+	// Streaming stops the response from being buffered once the handler writes a successful (2xx) status, e.g. for file downloads or SSE.
+	// The transaction is committed as the status is written, before the body, which then passes straight through to the client.
+	// An error or panic later in the handler can't roll back the transaction or change the response.
+	// Unsuccessful statuses are buffered & rolled back as usual. Default: false
+	Streaming bool
+	// OnPanic is called with the recovered value when the handler panics, after the transaction has been rolled back,
+	// e.g. to log or report the error
+	OnPanic func(rec interface{})
+	// RePanic re-raises the handler's panic after the transaction has been rolled back, so that upstream recovery
+	// middleware sees it. The response is then left to the upstream recovery to write.
+	// Default: false, the panic is swallowed & a StatusInternalServerError (500) is written
+	RePanic bool
+}
+
+// TxBeginner begins database transactions. It's satisfied by *sql.DB, *sqlx.DB
+// & any other type, e.g. a test double, which can begin a *sql.Tx
+type TxBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
 // Transaction middleware starts a database transaction and adds it to the request context.
 // The transaction will rollback if a non successful http status code is writen to the request, if a panic occurs during the handler
-func Transaction(db *sql.DB) Middleware {
+func Transaction(db TxBeginner) Middleware {
+	return TransactionWithOptions(db, TransactionOptions{})
+}
+
+// TransactionWithOptions middleware is Transaction configured with the supplied TransactionOptions
+func TransactionWithOptions(db TxBeginner, opts TransactionOptions) Middleware {
+	shouldCommit := opts.ShouldCommit
+	if shouldCommit == nil {
+		shouldCommit = isHTTPStatusOk
+	}
+	return transaction(db, opts, func(status int, body []byte) bool {
+		return shouldCommit(status)
+	})
+}
+
+// CommitIfValid middleware is Transaction which also requires the buffered response to pass the supplied validate func before committing.
+// It catches handlers which return a successful http status alongside an error payload in the body.
+// The transaction will rollback if the status isn't successful, if validate returns false or if a panic occurs during the handler
+func CommitIfValid(db TxBeginner, validate func(status int, body []byte) bool) Middleware {
+	return transaction(db, TransactionOptions{}, func(status int, body []byte) bool {
+		return isHTTPStatusOk(status) && validate(status, body)
+	})
+}
+
+// transaction creates the transaction middleware, committing when shouldCommit returns true for the buffered response
+func transaction(db TxBeginner, opts TransactionOptions, shouldCommit func(status int, body []byte) bool) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-			ctx := r.Context()
-			sw := &statusWriter{rw: w, buf: bytes.NewBuffer(nil)}
-
-			tx, err := db.BeginTx(ctx, nil)
-			if err != nil {
-				sw.WriteHeader(http.StatusInternalServerError)
-				sw.Finish()
-				return
+			// the request body is buffered so that it can be re-read by retried attempts
+			var body []byte
+			if opts.MaxRetries > 0 && r.Body != nil {
+				var err error
+				body, err = ioutil.ReadAll(r.Body)
+				r.Body.Close()
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
 			}
+			header := cloneHeader(w.Header())
 
-			defer func() {
-				if rec := recover(); rec != nil {
-					tx.Rollback()
-					sw.WriteHeader(http.StatusInternalServerError)
-					sw.Finish()
-					return
+			for attempt := 0; ; attempt++ {
+				req := r
+				if body != nil {
+					// each attempt reads the body from a shallow copy of the request, leaving the caller's request untouched
+					req = r.WithContext(r.Context())
+					req.Body = ioutil.NopCloser(bytes.NewReader(body))
+				}
+				sw := &statusWriter{rw: w, buf: bytes.NewBuffer(nil), maxBuffer: opts.MaxBufferSize}
+				if opts.Streaming {
+					sw.streamOnStatus = isHTTPStatusOk
 				}
 
-				if !isHTTPStatusOk(sw.status) {
-					tx.Rollback()
-					sw.Finish()
-					return
+				// only commit errors are retried, as documented, a transaction which fails to begin fails the request
+				begun, err := runTransaction(db, opts, shouldCommit, sw, next, req)
+				if err != nil && begun && attempt < opts.MaxRetries && opts.IsRetryable != nil && opts.IsRetryable(err) {
+					// discard the failed attempt's response headers
+					resetHeader(w.Header(), header)
+					continue
 				}
 
-				err := tx.Commit()
 				if err != nil {
-					tx.Rollback()
-					sw.WriteHeader(http.StatusInternalServerError)
-					sw.Finish()
-					return
+					sw.status = http.StatusInternalServerError
 				}
-
 				sw.Finish()
-			}()
-
-			txCtx := setTransaction(ctx, tx)
-			next.ServeHTTP(sw, r.WithContext(txCtx))
+				return
+			}
 		})
 	}
 }
 
+// runTransaction runs the handler in a transaction, writing its response to sw.
+// It returns whether the transaction began & the error if it failed to begin or commit
+func runTransaction(db TxBeginner, opts TransactionOptions, shouldCommit func(status int, body []byte) bool, sw *statusWriter, next http.Handler, r *http.Request) (begun bool, txErr error) {
+
+	ctx := r.Context()
+	start := time.Now()
+	tx, err := db.BeginTx(ctx, opts.TxOptions)
+	if err != nil {
+		return false, err
+	}
+
+	state := &txState{}
+	stats, _ := ctx.Value(txStatsKey).(*txStats)
+
+	completed := false
+	var commitErr error
+
+	// end commits or rolls back the transaction, only the first time it's called, returning the error if the commit failed
+	end := func(commit bool) error {
+		if completed {
+			return commitErr
+		}
+		completed = true
+
+		if !commit {
+			tx.Rollback()
+			stats.record(time.Since(start), false)
+			return nil
+		}
+
+		commitErr = tx.Commit()
+		if commitErr != nil {
+			tx.Rollback()
+			stats.record(time.Since(start), false)
+			return commitErr
+		}
+		stats.record(time.Since(start), true)
+		state.committed()
+		return nil
+	}
+
+	// complete commits or rolls back the transaction based on the response.
+	// A request whose context is done, e.g. timed out by Timeout, is rolled back as its response won't be sent
+	complete := func() error {
+		return end(ctx.Err() == nil && !state.isRollbackOnly() && shouldCommit(sw.status, sw.buf.Bytes()))
+	}
+
+	// a hijacked connection has no response status to decide on, so the transaction is committed unless marked for rollback
+	sw.beforeHijack = func() error {
+		return end(!state.isRollbackOnly())
+	}
+
+	sw.beforeStream = func() bool {
+		if err := complete(); err != nil {
+			sw.status = http.StatusInternalServerError
+			return false
+		}
+		return true
+	}
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			// the transaction was completed if streaming began
+			if !sw.streaming {
+				end(false)
+				sw.status = http.StatusInternalServerError
+			}
+			if opts.OnPanic != nil {
+				opts.OnPanic(rec)
+			}
+			if opts.RePanic {
+				panic(rec)
+			}
+			return
+		}
+
+		if sw.streaming {
+			return
+		}
+
+		txErr = complete()
+	}()
+
+	txCtx := setTransaction(ctx, tx)
+	txCtx = context.WithValue(txCtx, txStateKey, state)
+	next.ServeHTTP(sw, r.WithContext(txCtx))
+	return true, nil
+}
+
+// cloneHeader copies the header
+func cloneHeader(header http.Header) http.Header {
+	clone := make(http.Header, len(header))
+	for k, v := range header {
+		clone[k] = append([]string(nil), v...)
+	}
+	return clone
+}
+
+// resetHeader resets the header to the snapshot taken by cloneHeader
+func resetHeader(header http.Header, snapshot http.Header) {
+	for k := range header {
+		delete(header, k)
+	}
+	for k, v := range snapshot {
+		header[k] = append([]string(nil), v...)
+	}
+}
+
 // tx context key
 var txKey = &contextKey{"Tx"}
 
@@ -62,40 +245,251 @@ func setTransaction(ctx context.Context, tx *sql.Tx) context.Context {
 	return context.WithValue(ctx, txKey, tx)
 }
 
-// GetTransaction gets the transation stored in the context
+// GetTransaction gets the transation stored in the context, or nil if there isn't one, e.g. if the Transaction middleware wasn't applied
 func GetTransaction(ctx context.Context) *sql.Tx {
-	return ctx.Value(txKey).(*sql.Tx)
+	tx, _ := GetTransactionOk(ctx)
+	return tx
+}
+
+// GetTransactionOk gets the transation stored in the context, and whether there was one
+func GetTransactionOk(ctx context.Context) (*sql.Tx, bool) {
+	tx, ok := ctx.Value(txKey).(*sql.Tx)
+	return tx, ok
+}
+
+// tx state context key
+var txStateKey = &contextKey{"TxState"}
+
+// txState records decisions the handler has made about the outcome of its transaction
+type txState struct {
+	mu          sync.Mutex
+	rollback    bool
+	commitHooks []func()
+}
+
+// committed runs the commit hooks, in the order they were registered
+func (s *txState) committed() {
+	s.mu.Lock()
+	hooks := s.commitHooks
+	s.mu.Unlock()
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
+// isRollbackOnly checks if the handler has marked the transaction for rollback
+func (s *txState) isRollbackOnly() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rollback
+}
+
+// MarkRollback marks the request's transaction to be rolled back rather than committed, even when the response status is successful,
+// e.g. for a dry run request. It has no effect if the context doesn't have a transaction,
+// or once a response larger than MaxBufferSize has begun streaming, as the transaction has already been completed
+func MarkRollback(ctx context.Context) {
+	state, ok := ctx.Value(txStateKey).(*txState)
+	if !ok {
+		return
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.rollback = true
 }
 
-// statusWriter wraps ResponseWriter to intercept the written http status
+// OnCommit registers fn to be called once the request's transaction has been committed, e.g. to publish events about the changes made.
+// fn isn't called if the transaction is rolled back. It returns false if the context doesn't have a transaction
+func OnCommit(ctx context.Context, fn func()) bool {
+	state, ok := ctx.Value(txStateKey).(*txState)
+	if !ok {
+		return false
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.commitHooks = append(state.commitHooks, fn)
+	return true
+}
+
+// ResponseWriter is a http.ResponseWriter which captures the status & size of the response written through it,
+// e.g. for access logs & metrics
+type ResponseWriter interface {
+	http.ResponseWriter
+	// Status returns the response status, or 0 if one hasn't been written yet
+	Status() int
+	// BytesWritten returns the number of response body bytes written
+	BytesWritten() int
+}
+
+// NewResponseWriter wraps the http.ResponseWriter to capture the status & size of the response.
+// Writes pass straight through, nothing is buffered. Flush & Hijack are supported when w supports them.
+// Middleware composed around Transaction passes it this writer to read the response Transaction sends,
+// e.g. the StatusInternalServerError (500) which replaces the handler's status when the commit fails
+func NewResponseWriter(w http.ResponseWriter) ResponseWriter {
+	return &statusWriter{rw: w, buf: bytes.NewBuffer(nil), streamOnStatus: alwaysStream}
+}
+
+// alwaysStream is a statusWriter streamOnStatus which streams regardless of the status, i.e. never buffers
+func alwaysStream(status int) bool {
+	return true
+}
+
+// errResponseAborted is returned by statusWriter's Write once beforeStream has aborted the response
+var errResponseAborted = errors.New("Response aborted")
+
+// statusWriter wraps ResponseWriter to intercept the written http status.
+// The response body is buffered, up to maxBuffer bytes if set, after which the response is streamed
 type statusWriter struct {
-	rw     http.ResponseWriter
-	status int
-	buf    *bytes.Buffer
+	rw        http.ResponseWriter
+	status    int
+	buf       *bytes.Buffer
+	implicit  bool // status was defaulted by Write rather than set by WriteHeader
+	maxBuffer int  // number of bytes buffered before streaming, 0 for no limit
+	// beforeStream is called once, before the buffered response is flushed & streaming begins.
+	// Returning false aborts the response, writing only the status
+	beforeStream func() bool
+	// streamOnStatus begins streaming as soon as it returns true for the status written
+	streamOnStatus func(status int) bool
+	// beforeHijack is called before the connection is hijacked. Returning an error prevents the hijack
+	beforeHijack func() error
+	streaming    bool
+	aborted      bool
+	written      int // bytes written to rw
 }
 
-// WriteHeader wraps setting the status
+// WriteHeader wraps setting the status. Like http.ResponseWriter only the first call is honoured,
+// including the implicit StatusOK (200) of a Write, & later calls are ignored.
+// Informational (1xx) statuses, e.g. 103 Early Hints, aren't the final status so are written straight through
 func (sw *statusWriter) WriteHeader(status int) {
+	if isInformationalStatus(status) {
+		sw.rw.WriteHeader(status)
+		return
+	}
+	if sw.streaming || sw.status != 0 {
+		return
+	}
 	sw.status = status
+	if sw.streamOnStatus != nil && sw.streamOnStatus(status) {
+		sw.startStreaming()
+	}
 }
 
-// Write wraps ResponseWriter's Write and sets the http status if it hasn't already been set
+// isInformationalStatus checks if the http status is an interim 1xx response, other than 101 Switching Protocols which ends the response
+func isInformationalStatus(status int) bool {
+	return status >= 100 && status < 200 && status != http.StatusSwitchingProtocols
+}
+
+// Write wraps ResponseWriter's Write and sets the http status if it hasn't already been set.
+// Once the buffered body would grow past maxBuffer the buffer is flushed & writes go straight to the ResponseWriter
 func (sw *statusWriter) Write(b []byte) (int, error) {
 	if sw.status == 0 {
-		sw.status = http.StatusOK
+		sw.WriteHeader(http.StatusOK)
+		sw.implicit = true
+	}
+	if sw.aborted {
+		return 0, errResponseAborted
+	}
+	if sw.streaming {
+		return sw.writeThrough(b)
+	}
+	if sw.maxBuffer > 0 && sw.buf.Len()+len(b) > sw.maxBuffer {
+		if err := sw.startStreaming(); err != nil {
+			return 0, err
+		}
+		return sw.writeThrough(b)
 	}
 	return sw.buf.Write(b)
 }
 
+// startStreaming switches the writer to streaming, flushing the status & the buffered body
+func (sw *statusWriter) startStreaming() error {
+	if sw.beforeStream != nil && !sw.beforeStream() {
+		sw.buf.Reset()
+		sw.Finish()
+		sw.streaming = true
+		sw.aborted = true
+		return errResponseAborted
+	}
+	err := sw.Finish()
+	sw.streaming = true
+	sw.buf.Reset()
+	return err
+}
+
+// Flush implements http.Flusher, e.g. for SSE & chunked responses. As part of a buffered response can't be sent,
+// the status & buffered body are written first & the writer switches to streaming, locking in the transaction's commit/rollback decision
+func (sw *statusWriter) Flush() {
+	if !sw.streaming {
+		if sw.status == 0 {
+			sw.WriteHeader(http.StatusOK)
+			sw.implicit = true
+		}
+		if err := sw.startStreaming(); err != nil {
+			return
+		}
+	}
+	if flusher, ok := sw.rw.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker, e.g. for WebSocket upgrades, by delegating to the underlying ResponseWriter.
+// Within the Transaction middleware the transaction is committed, unless marked for rollback, before the connection is handed off,
+// as a hijacked connection has no response status to decide on. The hijack fails if the commit does.
+// Anything buffered is discarded, as the connection now belongs to the handler
+func (sw *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := sw.rw.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("The ResponseWriter doesn't support hijacking")
+	}
+	if sw.beforeHijack != nil {
+		if err := sw.beforeHijack(); err != nil {
+			return nil, nil, err
+		}
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	sw.streaming = true
+	sw.buf.Reset()
+	return conn, rw, nil
+}
+
 // Header wraps ResponseWriter's Header
 func (sw *statusWriter) Header() http.Header {
 	return sw.rw.Header()
 }
 
+// Finish writes the status & the buffered body to the ResponseWriter.
+// It does nothing once streaming has begun, as the response has already been written
 func (sw *statusWriter) Finish() error {
+	if sw.streaming {
+		return nil
+	}
 	if sw.status != 0 {
 		sw.rw.WriteHeader(sw.status)
 	}
-	_, err := sw.rw.Write(sw.buf.Bytes())
+	if sw.buf.Len() == 0 {
+		return nil
+	}
+	_, err := sw.writeThrough(sw.buf.Bytes())
 	return err
 }
+
+// writeThrough writes to the ResponseWriter, counting the bytes written
+func (sw *statusWriter) writeThrough(b []byte) (int, error) {
+	n, err := sw.rw.Write(b)
+	sw.written += n
+	return n, err
+}
+
+// Status returns the response status, or 0 if one hasn't been written yet
+func (sw *statusWriter) Status() int {
+	return sw.status
+}
+
+// BytesWritten returns the number of response body bytes written to the underlying ResponseWriter,
+// i.e. flushed by Finish or streamed. Bytes still buffered aren't counted
+func (sw *statusWriter) BytesWritten() int {
+	return sw.written
+}
@@ -1,9 +1,18 @@
 package middleware
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
 	"errors"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 
 	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
@@ -95,9 +104,9 @@ func TestTransactionCommitReadTransactionInHandler(t *testing.T) {
 	mock.ExpectRollback()
 
 	handler := Transaction(db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tx := GetTransaction(r.Context())
-		if tx == nil {
-			panic(errors.New("GetTransaction should return a *sql.Tx"))
+		tx, ok := GetTransactionOk(r.Context())
+		if !ok || tx == nil {
+			panic(errors.New("GetTransactionOk should return a *sql.Tx"))
 		}
 
 	}))
@@ -188,3 +197,978 @@ func TestTransactionErrorDuringTxBegin(t *testing.T) {
 		t.Fatalf("StatusInternalServerError 500 expected but was %v", w.Code)
 	}
 }
+
+// isValidBody is a CommitIfValid validator which rejects error shaped bodies
+func isValidBody(status int, body []byte) bool {
+	return !strings.Contains(string(body), `"error"`)
+}
+
+func TestCommitIfValidCommitValidBody(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	handler := CommitIfValid(db, isValidBody)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"id":1}`))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expected the transaction to be committed: %v", err)
+	}
+}
+
+func TestCommitIfValidRollbackErrorBody(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	handler := CommitIfValid(db, isValidBody)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"error":"something went wrong"}`))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	if s := string(w.Body.Bytes()); s != `{"error":"something went wrong"}` {
+		t.Fatalf("Expected the handler's body to be written but was %v", s)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expected the transaction to be rolled back: %v", err)
+	}
+}
+
+// TestTransactionSmallResponseBuffered tests that a response within MaxBufferSize is buffered, so a failed commit still replaces the status
+func TestTransactionSmallResponseBuffered(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectCommit().WillReturnError(errors.New("Commit failed"))
+
+	handler := TransactionWithOptions(db, TransactionOptions{MaxBufferSize: 16})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("small"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("StatusInternalServerError 500 expected but was %v", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unmet sql expectations: %v", err)
+	}
+}
+
+// TestTransactionLargeResponseStreamed tests that a response larger than MaxBufferSize is streamed once the transaction is committed
+func TestTransactionLargeResponseStreamed(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	body := strings.Repeat("large", 10)
+	handler := TransactionWithOptions(db, TransactionOptions{MaxBufferSize: 16})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(body[:10]))
+		w.Write([]byte(body[10:]))
+
+		// Assert the decision was locked in as streaming began
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatalf("Expected the transaction to be committed before streaming: %v", err)
+		}
+		if !w.(*statusWriter).streaming {
+			t.Fatal("Expected the response to be streaming")
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusCreated {
+		t.Fatalf("StatusCreated 201 expected but was %v", w.Code)
+	}
+	if s := w.Body.String(); s != body {
+		t.Fatalf("Expected the whole body to be streamed but was %v", s)
+	}
+}
+
+// TestTransactionStreamCommitError tests that a failed commit as streaming begins aborts the response with a 500
+func TestTransactionStreamCommitError(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectCommit().WillReturnError(errors.New("Commit failed"))
+
+	var writeErr error
+	handler := TransactionWithOptions(db, TransactionOptions{MaxBufferSize: 16})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, writeErr = w.Write([]byte(strings.Repeat("large", 10)))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("StatusInternalServerError 500 expected but was %v", w.Code)
+	}
+	if writeErr == nil {
+		t.Fatal("Expected the handler's write to fail")
+	}
+	if w.Body.Len() != 0 {
+		t.Fatalf("Expected an empty body but was %v", w.Body.String())
+	}
+}
+
+// txOptionsDriver is a database/sql driver which records the options transactions are started with.
+// sqlmock ignores them, so can't be used to test them
+type txOptionsDriver struct {
+	opts driver.TxOptions
+}
+
+func (d *txOptionsDriver) Open(name string) (driver.Conn, error) {
+	return txOptionsConn{d}, nil
+}
+
+// Connect implements driver.Connector, so that the driver can be used without registering it
+func (d *txOptionsDriver) Connect(ctx context.Context) (driver.Conn, error) {
+	return d.Open("")
+}
+
+func (d *txOptionsDriver) Driver() driver.Driver {
+	return d
+}
+
+// txOptionsConn is a connection of the txOptionsDriver
+type txOptionsConn struct {
+	driver *txOptionsDriver
+}
+
+func (c txOptionsConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("Prepare isn't supported")
+}
+
+func (c txOptionsConn) Close() error {
+	return nil
+}
+
+func (c txOptionsConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c txOptionsConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.driver.opts = opts
+	return txOptionsTx{}, nil
+}
+
+// txOptionsTx is a transaction of the txOptionsDriver
+type txOptionsTx struct{}
+
+func (tx txOptionsTx) Commit() error {
+	return nil
+}
+
+func (tx txOptionsTx) Rollback() error {
+	return nil
+}
+
+// TestTransactionWithOptionsReadOnly tests that the TxOptions are used to start the transaction
+func TestTransactionWithOptionsReadOnly(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	txDriver := &txOptionsDriver{}
+	db := sql.OpenDB(txDriver)
+	defer db.Close()
+
+	options := TransactionOptions{TxOptions: &sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true}}
+	handler := TransactionWithOptions(db, options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	if !txDriver.opts.ReadOnly {
+		t.Fatal("Expected a read only transaction to be started")
+	}
+	if sql.IsolationLevel(txDriver.opts.Isolation) != sql.LevelSerializable {
+		t.Fatalf("Expected a serializable transaction but was %v", txDriver.opts.Isolation)
+	}
+}
+
+// TestTransactionMarkRollback tests that a transaction marked for rollback is rolled back even though the status is successful
+func TestTransactionMarkRollback(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/?dryRun=true", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	handler := Transaction(db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		MarkRollback(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expected the transaction to be rolled back: %v", err)
+	}
+}
+
+// TestGetTransactionNotSet tests that GetTransaction returns nil, rather than panicking, when the context doesn't have a transaction
+func TestGetTransactionNotSet(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+
+	// Act
+	tx := GetTransaction(r.Context())
+	_, ok := GetTransactionOk(r.Context())
+
+	// Assert
+	if tx != nil {
+		t.Fatal("Expected GetTransaction to return nil")
+	}
+	if ok {
+		t.Fatal("Expected GetTransactionOk to report there isn't a transaction")
+	}
+}
+
+// commitRedirects is a ShouldCommit rule which commits 2xx & 3xx statuses
+func commitRedirects(status int) bool {
+	return status >= 200 && status < 400
+}
+
+// TestTransactionShouldCommitRedirect tests that a custom ShouldCommit rule can commit a redirect
+func TestTransactionShouldCommitRedirect(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	handler := TransactionWithOptions(db, TransactionOptions{ShouldCommit: commitRedirects})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusFound)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusFound {
+		t.Fatalf("StatusFound 302 expected but was %v", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expected the transaction to be committed: %v", err)
+	}
+}
+
+// TestTransactionShouldCommitConflict tests that a custom ShouldCommit rule rolls back a conflict
+func TestTransactionShouldCommitConflict(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	handler := TransactionWithOptions(db, TransactionOptions{ShouldCommit: commitRedirects})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusConflict {
+		t.Fatalf("StatusConflict 409 expected but was %v", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expected the transaction to be rolled back: %v", err)
+	}
+}
+
+// errSerialization is a retryable commit error
+var errSerialization = errors.New("could not serialize access due to concurrent update")
+
+// TestTransactionRetryCommitError tests that the handler is re-run in a fresh transaction when the commit fails with a retryable error
+func TestTransactionRetryCommitError(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/", strings.NewReader("request body"))
+	body := r.Body
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectCommit().WillReturnError(errSerialization)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	options := TransactionOptions{
+		MaxRetries: 2,
+		IsRetryable: func(err error) bool {
+			return err == errSerialization
+		},
+	}
+	attempts := 0
+	handler := TransactionWithOptions(db, options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != "request body" {
+			t.Fatalf("Expected each attempt to read the request body but was %s", body)
+		}
+		w.Header().Add("X-Attempt", strconv.Itoa(attempts))
+		w.Write([]byte("attempt " + strconv.Itoa(attempts)))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if r.Body != body {
+		t.Fatal("Expected the caller's request body to be left in place")
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	if attempts != 2 {
+		t.Fatalf("Expected the handler to be run twice but was run %v times", attempts)
+	}
+	if s := w.Body.String(); s != "attempt 2" {
+		t.Fatalf("Expected only the second attempt's body but was %v", s)
+	}
+	if h := w.Header()["X-Attempt"]; len(h) != 1 || h[0] != "2" {
+		t.Fatalf("Expected only the second attempt's header but was %v", h)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unmet sql expectations: %v", err)
+	}
+}
+
+// TestTransactionRetryNotRetryable tests that a commit error which isn't retryable fails the request
+func TestTransactionRetryNotRetryable(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectCommit().WillReturnError(errors.New("Connection reset"))
+
+	options := TransactionOptions{
+		MaxRetries: 2,
+		IsRetryable: func(err error) bool {
+			return err == errSerialization
+		},
+	}
+	attempts := 0
+	handler := TransactionWithOptions(db, options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("StatusInternalServerError 500 expected but was %v", w.Code)
+	}
+	if attempts != 1 {
+		t.Fatalf("Expected the handler to be run once but was run %v times", attempts)
+	}
+}
+
+// TestTransactionRetryBeginError tests that a BeginTx error isn't retried, even when IsRetryable accepts it
+func TestTransactionRetryBeginError(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin().WillReturnError(errSerialization)
+
+	options := TransactionOptions{
+		MaxRetries: 2,
+		IsRetryable: func(err error) bool {
+			return err == errSerialization
+		},
+	}
+	handler := TransactionWithOptions(db, options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Next handler should not have been called")
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("StatusInternalServerError 500 expected but was %v", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unmet sql expectations: %v", err)
+	}
+}
+
+// timedWriter is a ResponseWriter which records the order events reach it in
+type timedWriter struct {
+	header http.Header
+	status int
+	events *[]string
+}
+
+func (tw *timedWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timedWriter) WriteHeader(status int) {
+	tw.status = status
+	*tw.events = append(*tw.events, "status "+strconv.Itoa(status))
+}
+
+func (tw *timedWriter) Write(b []byte) (int, error) {
+	*tw.events = append(*tw.events, "write "+string(b))
+	return len(b), nil
+}
+
+// TestTransactionStreaming tests that in streaming mode the transaction is committed as the 2xx status is written, & the body then flushed incrementally
+func TestTransactionStreaming(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/download", nil)
+	events := []string{}
+	w := &timedWriter{header: http.Header{}, events: &events}
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	handler := TransactionWithOptions(db, TransactionOptions{Streaming: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatalf("Expected the transaction to be committed before the body: %v", err)
+		}
+		events = append(events, "handler chunk 1")
+		w.Write([]byte("chunk 1"))
+		events = append(events, "handler chunk 2")
+		w.Write([]byte("chunk 2"))
+		panic(errors.New("A late error can't roll back a streamed response"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.status != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.status)
+	}
+	expected := []string{"status 200", "handler chunk 1", "write chunk 1", "handler chunk 2", "write chunk 2"}
+	if strings.Join(events, ", ") != strings.Join(expected, ", ") {
+		t.Fatalf("Expected the writes %v but were %v", expected, events)
+	}
+}
+
+// TestTransactionStreamingErrorStatus tests that in streaming mode an unsuccessful status is still buffered & rolled back
+func TestTransactionStreamingErrorStatus(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/download", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	handler := TransactionWithOptions(db, TransactionOptions{Streaming: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("not found"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("StatusNotFound 404 expected but was %v", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expected the transaction to be rolled back: %v", err)
+	}
+}
+
+// countingBeginner is a TxBeginner which counts the transactions it begins
+type countingBeginner struct {
+	db    *sql.DB
+	begun int
+}
+
+func (b *countingBeginner) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	b.begun++
+	return b.db.BeginTx(ctx, opts)
+}
+
+// TestTransactionCustomTxBeginner tests that any TxBeginner can be used to begin the transaction
+func TestTransactionCustomTxBeginner(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	beginner := &countingBeginner{db: db}
+
+	handler := Transaction(beginner)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	if beginner.begun != 1 {
+		t.Fatalf("Expected the custom TxBeginner to begin 1 transaction but began %v", beginner.begun)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Unmet sql expectations: %v", err)
+	}
+}
+
+// TestTransactionOnPanic tests that the OnPanic hook receives the original panic value & the 500 is still written
+func TestTransactionOnPanic(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	panicErr := errors.New("EVERYTHING IS ON FIRE, DON'T COMMIT")
+	var recovered interface{}
+	options := TransactionOptions{
+		OnPanic: func(rec interface{}) {
+			recovered = rec
+		},
+	}
+	handler := TransactionWithOptions(db, options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(panicErr)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("StatusInternalServerError 500 expected but was %v", w.Code)
+	}
+	if recovered != panicErr {
+		t.Fatalf("Expected the OnPanic hook to receive the panic value but was %v", recovered)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expected the transaction to be rolled back: %v", err)
+	}
+}
+
+// TestTransactionRePanic tests that the panic is re-raised after the transaction is rolled back
+func TestTransactionRePanic(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	panicErr := errors.New("EVERYTHING IS ON FIRE, DON'T COMMIT")
+	handler := TransactionWithOptions(db, TransactionOptions{RePanic: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(panicErr)
+	}))
+
+	// Act
+	var recovered interface{}
+	func() {
+		defer func() {
+			recovered = recover()
+		}()
+		handler.ServeHTTP(w, r)
+	}()
+
+	// Assert
+	if recovered != panicErr {
+		t.Fatalf("Expected the panic to be re-raised but was %v", recovered)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expected the transaction to be rolled back: %v", err)
+	}
+}
+
+// TestTransactionFlusher tests that the wrapped writer is a http.Flusher, & that Flush commits the transaction & reaches the underlying writer
+func TestTransactionFlusher(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/events", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	handler := Transaction(db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatal("Expected the wrapped writer to be a http.Flusher")
+		}
+		w.Write([]byte("data: 1\n\n"))
+		flusher.Flush()
+
+		// Assert
+		if !w.(*statusWriter).rw.(*httptest.ResponseRecorder).Flushed {
+			t.Fatal("Expected Flush to reach the underlying writer")
+		}
+		if body := w.(*statusWriter).rw.(*httptest.ResponseRecorder).Body.String(); body != "data: 1\n\n" {
+			t.Fatalf("Expected the buffered body to be drained before flushing but was %v", body)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatalf("Expected the transaction to be committed on Flush: %v", err)
+		}
+		w.Write([]byte("data: 2\n\n"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	if body := w.Body.String(); body != "data: 1\n\ndata: 2\n\n" {
+		t.Fatalf("Expected both events to be written but was %v", body)
+	}
+}
+
+// hijackableWriter is a ResponseWriter which supports hijacking
+type hijackableWriter struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (hw *hijackableWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hw.hijacked = true
+	server, client := net.Pipe()
+	client.Close()
+	return server, bufio.NewReadWriter(bufio.NewReader(server), bufio.NewWriter(server)), nil
+}
+
+// TestTransactionHijack tests that the transaction is committed before the connection is handed off to the handler
+func TestTransactionHijack(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/ws", nil)
+	w := &hijackableWriter{ResponseRecorder: httptest.NewRecorder()}
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	handler := Transaction(db)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		hijacker, ok := rw.(http.Hijacker)
+		if !ok {
+			t.Fatal("Expected the wrapped writer to be a http.Hijacker")
+		}
+		conn, _, err := hijacker.Hijack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		// Assert
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatalf("Expected the transaction to be committed before the hijack: %v", err)
+		}
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if !w.hijacked {
+		t.Fatal("Expected the underlying writer to be hijacked")
+	}
+	if w.ResponseRecorder.Body.Len() != 0 {
+		t.Fatalf("Expected nothing to be written after the hijack but was %v", w.ResponseRecorder.Body.String())
+	}
+}
+
+// TestTransactionHijackNotSupported tests that a clear error is returned when the underlying writer can't be hijacked
+func TestTransactionHijackNotSupported(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/ws", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	var hijackErr error
+	handler := Transaction(db)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		_, _, hijackErr = rw.(http.Hijacker).Hijack()
+		rw.WriteHeader(http.StatusNotImplemented)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if hijackErr == nil {
+		t.Fatal("Expected hijacking to fail")
+	}
+	if w.Code != http.StatusNotImplemented {
+		t.Fatalf("StatusNotImplemented 501 expected but was %v", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expected the transaction to be rolled back: %v", err)
+	}
+}
+
+// TestTransactionMultipleWriteHeader tests that only the first WriteHeader is honoured, like http.ResponseWriter
+func TestTransactionMultipleWriteHeader(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	handler := Transaction(db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expected the transaction to be committed: %v", err)
+	}
+}
+
+// TestTransactionInformationalStatus tests that a 1xx status is written straight through rather than taken as the final status
+func TestTransactionInformationalStatus(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	events := []string{}
+	w := &timedWriter{header: http.Header{}, events: &events}
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	var sw ResponseWriter
+	handler := Transaction(db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw = w.(ResponseWriter)
+		w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Test"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	expected := []string{"status 103", "status 200", "write Test"}
+	if strings.Join(events, ", ") != strings.Join(expected, ", ") {
+		t.Fatalf("Expected the writes %v but were %v", expected, events)
+	}
+	if sw.Status() != http.StatusOK {
+		t.Fatalf("Expected the final status StatusOK 200 but was %v", sw.Status())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("Expected the transaction to be committed: %v", err)
+	}
+}
+
+// TestTransactionOuterResponseWriter tests that middleware composed around Transaction can read the status & size
+// of the response Transaction sends, including the StatusInternalServerError (500) written when the commit fails
+func TestTransactionOuterResponseWriter(t *testing.T) {
+
+	tests := []struct {
+		commitErr error
+		status    int
+		size      int
+	}{
+		{nil, http.StatusCreated, len("created")},
+		{errors.New("Commit failed"), http.StatusInternalServerError, len("created")},
+	}
+
+	for _, test := range tests {
+
+		// Arrange
+		r, _ := http.NewRequest("POST", "/", nil)
+		db, mock, _ := sqlmock.New()
+		mock.ExpectBegin()
+		mock.ExpectCommit().WillReturnError(test.commitErr)
+
+		var rw ResponseWriter
+		outer := func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				rw = NewResponseWriter(w)
+				next.ServeHTTP(rw, r)
+			})
+		}
+		handler := outer(Transaction(db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("created"))
+		})))
+
+		// Act
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		db.Close()
+
+		// Assert
+		if rw.Status() != test.status || rw.BytesWritten() != test.size {
+			t.Fatalf("Expected status %v & size %v but was %v & %v", test.status, test.size, rw.Status(), rw.BytesWritten())
+		}
+	}
+}
+
+// TestStatusWriterBytesWritten tests that the reported size equals the bytes the handler wrote, once they've been flushed
+func TestStatusWriterBytesWritten(t *testing.T) {
+
+	// Arrange
+	w := httptest.NewRecorder()
+	sw := &statusWriter{rw: w, buf: bytes.NewBuffer(nil)}
+
+	// Act
+	sw.WriteHeader(http.StatusCreated)
+	sw.Write([]byte("Hello "))
+	sw.Write([]byte("world"))
+	buffered := sw.BytesWritten()
+	sw.Finish()
+
+	// Assert
+	if buffered != 0 {
+		t.Fatalf("Expected buffered bytes not to be counted but was %v", buffered)
+	}
+	if size := sw.BytesWritten(); size != len("Hello world") {
+		t.Fatalf("Expected %v bytes written but was %v", len("Hello world"), size)
+	}
+	if status := sw.Status(); status != http.StatusCreated {
+		t.Fatalf("StatusCreated 201 expected but was %v", status)
+	}
+}
+
+// TestStatusWriterBytesWrittenStreaming tests that streamed bytes are counted
+func TestStatusWriterBytesWrittenStreaming(t *testing.T) {
+
+	// Arrange
+	w := httptest.NewRecorder()
+	sw := &statusWriter{rw: w, buf: bytes.NewBuffer(nil), maxBuffer: 4}
+
+	// Act
+	sw.Write([]byte("abc"))
+	sw.Write([]byte("defgh"))
+	sw.Finish()
+
+	// Assert
+	if size := sw.BytesWritten(); size != w.Body.Len() || size != 8 {
+		t.Fatalf("Expected 8 bytes written but was %v", size)
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// ResponseTransformer modifies a buffered response before it is written.
+// It's given the response's status, headers & body and returns the new body.
+// Headers can be modified in place. Returning an error fails the request with a StatusInternalServerError (500)
+type ResponseTransformer interface {
+	Transform(status int, header http.Header, body []byte) ([]byte, error)
+}
+
+// ResponseTransformerFunc is an adapter to allow the use of ordinary functions as ResponseTransformers
+type ResponseTransformerFunc func(status int, header http.Header, body []byte) ([]byte, error)
+
+// Transform calls f(status, header, body)
+func (f ResponseTransformerFunc) Transform(status int, header http.Header, body []byte) ([]byte, error) {
+	return f(status, header, body)
+}
+
+// Transform middleware applies the transformers, in order, to the buffered response before it's written.
+// It composes concerns like redaction, enveloping & key casing into a single buffered pass,
+// avoiding the overhead of buffering the response once per concern when nesting several buffering middleware.
+func Transform(transformers ...ResponseTransformer) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			sw := &statusWriter{rw: w, buf: bytes.NewBuffer(nil)}
+			next.ServeHTTP(sw, r)
+
+			status := sw.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			body := sw.buf.Bytes()
+			for _, transformer := range transformers {
+				var err error
+				body, err = transformer.Transform(status, w.Header(), body)
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+			}
+
+			w.Header().Del("Content-Length")
+			sw.buf = bytes.NewBuffer(body)
+			sw.Finish()
+		})
+	}
+}
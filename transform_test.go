@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestTransformInOrder tests that the transformers are applied to the response in order
+func TestTransformInOrder(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	redact := ResponseTransformerFunc(func(status int, header http.Header, body []byte) ([]byte, error) {
+		return bytes.Replace(body, []byte("secret"), []byte("[REDACTED]"), -1), nil
+	})
+	envelope := ResponseTransformerFunc(func(status int, header http.Header, body []byte) ([]byte, error) {
+		header.Set("Content-Type", "application/json")
+		return append(append([]byte(`{"data":`), body...), '}'), nil
+	})
+	handler := Transform(redact, envelope)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`"my secret"`))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	if s := w.Body.String(); s != `{"data":"my [REDACTED]"}` {
+		t.Fatalf("Expected both transformers to be applied in order but was %v", s)
+	}
+	if h := w.Header().Get("Content-Type"); h != "application/json" {
+		t.Fatalf("Expected the transformer's Content-Type header but was %v", h)
+	}
+}
+
+// TestTransformError tests that StatusInternalServerError is returned when a transformer fails
+func TestTransformError(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	failing := ResponseTransformerFunc(func(status int, header http.Header, body []byte) ([]byte, error) {
+		return nil, errors.New("transform failed")
+	})
+	handler := Transform(failing)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Test"))
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("StatusInternalServerError 500 expected but was %v", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Fatalf("Expected an empty body but was %v", w.Body.String())
+	}
+}
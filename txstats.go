@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TxStatsOptions defines the user supplied TxStatsHeader configuration options.
+type TxStatsOptions struct {
+	// Header is the name of the debug response header
+	Header string
+	// Trusted decides whether the request may see the debug header, e.g. based on the client's IP or a debug token
+	// Default: no request is trusted, so the header is never written
+	Trusted func(*http.Request) bool
+}
+
+// TxStatsHeader middleware writes a debug response header summarizing the request's transaction, for quick per request database diagnostics in development, e.g.
+//
+//	X-Tx-Stats: duration=4.2ms; committed=true; queries=3
+//
+// The header is only written when a transaction ran. It must run before Transaction. The number of queries is included
+// when the QueryLog middleware runs before TxStatsHeader. Every request is trusted, so only use it in development.
+// Use TxStatsHeaderWithOptions to restrict the header to trusted requests.
+// The header is added as the transaction's status is written, so it's missing if Transaction streamed the response before committing
+func TxStatsHeader(header string) Middleware {
+	return TxStatsHeaderWithOptions(TxStatsOptions{
+		Header:  header,
+		Trusted: func(*http.Request) bool { return true },
+	})
+}
+
+// TxStatsHeaderWithOptions middleware is TxStatsHeader configured with the supplied TxStatsOptions
+func TxStatsHeaderWithOptions(options TxStatsOptions) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if options.Trusted == nil || !options.Trusted(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			stats := &txStats{}
+			ctx := context.WithValue(r.Context(), txStatsKey, stats)
+			tw := &txStatsWriter{rw: w, writeStats: func() {
+				if summary, ok := stats.summary(); ok {
+					if queries := GetQueryLog(ctx); queries != nil {
+						summary += fmt.Sprintf("; queries=%d", len(queries))
+					}
+					w.Header().Set(options.Header, summary)
+				}
+			}}
+			next.ServeHTTP(tw, r.WithContext(ctx))
+			if !tw.wroteHeader {
+				// net/http writes the implicit status once the handler returns
+				tw.writeStats()
+			}
+		})
+	}
+}
+
+// tx stats context key
+var txStatsKey = &contextKey{"TxStats"}
+
+// txStats records the outcome of the request's transaction
+type txStats struct {
+	mu        sync.Mutex
+	ran       bool
+	duration  time.Duration
+	committed bool
+}
+
+// record records the transaction's outcome. It does nothing if TxStatsHeader isn't in use
+func (s *txStats) record(duration time.Duration, committed bool) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ran = true
+	s.duration = duration
+	s.committed = committed
+}
+
+// summary formats the recorded outcome, returning false if no transaction ran
+func (s *txStats) summary() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ran {
+		return "", false
+	}
+	return fmt.Sprintf("duration=%v; committed=%t", s.duration, s.committed), true
+}
+
+// txStatsWriter wraps ResponseWriter to add the stats header just before the status is written.
+// Unlike statusWriter the response isn't buffered, so Transaction's MaxBufferSize & streaming still apply
+type txStatsWriter struct {
+	rw          http.ResponseWriter
+	writeStats  func()
+	wroteHeader bool
+}
+
+// Header wraps ResponseWriter's Header
+func (tw *txStatsWriter) Header() http.Header {
+	return tw.rw.Header()
+}
+
+// WriteHeader adds the stats header before writing the status. Informational (1xx) statuses are written straight through
+func (tw *txStatsWriter) WriteHeader(status int) {
+	if !tw.wroteHeader && !isInformationalStatus(status) {
+		tw.wroteHeader = true
+		tw.writeStats()
+	}
+	tw.rw.WriteHeader(status)
+}
+
+// Write wraps ResponseWriter's Write, adding the stats header if the status hasn't been written yet
+func (tw *txStatsWriter) Write(b []byte) (int, error) {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	return tw.rw.Write(b)
+}
+
+// Flush implements http.Flusher by delegating to the underlying ResponseWriter
+func (tw *txStatsWriter) Flush() {
+	if flusher, ok := tw.rw.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker by delegating to the underlying ResponseWriter
+func (tw *txStatsWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := tw.rw.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("The ResponseWriter doesn't support hijacking")
+	}
+	return hijacker.Hijack()
+}
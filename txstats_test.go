@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// TestTxStatsHeaderPresent tests that the header summarizes the transaction's duration, outcome & queries
+func TestTxStatsHeaderPresent(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE accounts").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	handler := QueryLog()(TxStatsHeader("X-Tx-Stats")(Transaction(db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := TxExec(r.Context(), "UPDATE accounts SET balance = 0"); err != nil {
+			t.Fatal(err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if w.Code != http.StatusOK {
+		t.Fatalf("StatusOK 200 expected but was %v", w.Code)
+	}
+	stats := w.Header().Get("X-Tx-Stats")
+	for _, field := range []string{"duration=", "committed=true", "queries=1"} {
+		if !strings.Contains(stats, field) {
+			t.Fatalf("Expected the X-Tx-Stats header to contain %s but was %s", field, stats)
+		}
+	}
+}
+
+// TestTxStatsHeaderRolledBack tests that the header reports a rolled back transaction, without queries when QueryLog isn't in use
+func TestTxStatsHeaderRolledBack(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("POST", "/", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	handler := TxStatsHeader("X-Tx-Stats")(Transaction(db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	})))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	stats := w.Header().Get("X-Tx-Stats")
+	if !strings.Contains(stats, "committed=false") || strings.Contains(stats, "queries=") {
+		t.Fatalf("Expected the X-Tx-Stats header to report a rollback without queries but was %s", stats)
+	}
+}
+
+// TestTxStatsHeaderNoTransaction tests that the header is absent when no transaction ran
+func TestTxStatsHeaderNoTransaction(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler := TxStatsHeader("X-Tx-Stats")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if stats := w.Header().Get("X-Tx-Stats"); stats != "" {
+		t.Fatalf("Expected no X-Tx-Stats header but was %s", stats)
+	}
+}
+
+// TestTxStatsHeaderUntrusted tests that the header is absent for untrusted requests
+func TestTxStatsHeaderUntrusted(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	options := TxStatsOptions{
+		Header: "X-Tx-Stats",
+		Trusted: func(r *http.Request) bool {
+			return r.Header.Get("X-Debug-Token") == "let-me-in"
+		},
+	}
+	handler := TxStatsHeaderWithOptions(options)(Transaction(db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if stats := w.Header().Get("X-Tx-Stats"); stats != "" {
+		t.Fatalf("Expected no X-Tx-Stats header but was %s", stats)
+	}
+}
+
+// TestTxStatsHeaderNoTrustedFunc tests that the header is absent when no Trusted function is configured
+func TestTxStatsHeaderNoTrustedFunc(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	handler := TxStatsHeaderWithOptions(TxStatsOptions{Header: "X-Tx-Stats"})(Transaction(db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	if stats := w.Header().Get("X-Tx-Stats"); stats != "" {
+		t.Fatalf("Expected no X-Tx-Stats header but was %s", stats)
+	}
+}
+
+// TestTxStatsHeaderStreamsLargeResponse tests that the response isn't buffered, so Transaction's MaxBufferSize still applies
+func TestTxStatsHeaderStreamsLargeResponse(t *testing.T) {
+
+	// Arrange
+	r, _ := http.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	var streamed string
+	options := TransactionOptions{MaxBufferSize: 4}
+	handler := TxStatsHeader("X-Tx-Stats")(TransactionWithOptions(db, options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("streamed"))
+		streamed = rec.Body.String()
+	})))
+
+	// Act
+	handler.ServeHTTP(rec, r)
+
+	// Assert
+	if streamed != "streamed" {
+		t.Fatalf("Expected the body to be streamed before the handler returned but was %s", streamed)
+	}
+}